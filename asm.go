@@ -0,0 +1,48 @@
+package main
+
+import (
+	"chip8-emulator/core"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Asm assembles the source file given with src= into a ROM, written to out=
+// or next to the source with a .ch8 extension.
+func Asm(config *Config) error {
+	if config.source == "" {
+		return errors.New("asm needs src=<file>")
+	}
+
+	file, err := os.Open(config.source)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	rom, err := core.Assemble(file, config.currentExtension)
+	var asmErrors core.AsmErrors
+	if errors.As(err, &asmErrors) {
+		for _, e := range asmErrors {
+			fmt.Fprintf(os.Stderr, "%s:%v\n", config.source, e)
+		}
+		return fmt.Errorf("%s: %d errors", config.source, len(asmErrors))
+	}
+	if err != nil {
+		return err
+	}
+
+	output := config.output
+	if output == "" {
+		output = strings.TrimSuffix(config.source, filepath.Ext(config.source)) + ".ch8"
+	}
+
+	if err := os.WriteFile(output, rom, 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %d bytes to %s\n", len(rom), output)
+
+	return nil
+}
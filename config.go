@@ -1,7 +1,10 @@
 package main
 
 import (
+	"chip8-emulator/core"
+	"crypto/sha1"
 	"log"
+	"math/rand/v2"
 	"os"
 	"strconv"
 	"strings"
@@ -12,36 +15,102 @@ type Config struct {
 	window_height    int32
 	fgColor          uint32
 	bgColor          uint32
+	fg2Color         uint32 // XO-CHIP plane 2 color
+	blendColor       uint32 // XO-CHIP color where both planes are lit
 	scale            uint32
 	pixelOutlines    bool
 	romName          string
+	mode             string // Subcommand to run instead of the emulator, e.g. disasm
+	source           string // asm input file
+	output           string // asm output file
+	goldenDir        string // test mode golden screen directory
+	updateGolden     bool   // test mode rewrites the golden screens instead of checking them
+	loadState        string // Savestate to restore after loading the ROM
+	saveState        string // Savestate to write when the emulator quits
+	recordMovie      string // Movie file to record keypad input into
+	playMovie        string // Movie file to replay keypad input from
+	rewindSeconds    uint32 // Rewind history length, 0 disables rewind
+	rewindMemory     uint32 // Rewind history budget in MiB
 	instsPerSecond   uint32 // CHIP8 CPU "clock rate" or hz
+	vipTiming        bool   // Charge instructions their COSMAC VIP cycle cost instead of using instsPerSecond
+	seed             uint64 // CXNN random seed
+	vipRandom        bool   // Emulate the COSMAC VIP interpreter's random routine for CXNN
+	debug            bool   // Pause in the stdin debugger console
+	gdbAddr          string // Serve the GDB remote protocol on this TCP address
+	tracePath        string // Instruction trace log file
+	traceFormat      string // Comma separated trace line fields
+	traceFilter      string // Comma separated PC ranges to trace
+	traceRing        uint32 // Keep only this many trace lines, written on a fault or break
+	profilerPath     string // Execution profiler report written at exit, - for stdout
+	profilerTop      uint32 // Number of hottest addresses in the profiler report
+	heatmapPath      string // RAM execution heatmap written at exit, .png or .html
+	romDBPath        string // User ROM database, overrides the built-in entries
+	configPath       string // JSON config file, "" for the one in the user config directory
 	volume           int16
-	currentExtension Extension
+	currentExtension core.Extension
+	quirks           core.Quirks
 	colorLerpRate    float32
+	romInfo          *core.RomInfo // ROM database entry for the ROM, nil if unknown
 }
 
-type Extension int
-
-const (
-	CHIP_8 Extension = iota
-	SUPERCHIP
-	XOCHIP
-)
-
 func (config *Config) SetConfigFromArgs() {
 	// defaults
 	config.window_width, config.window_height = 64, 32
-	config.fgColor, config.bgColor = 0xFFFFFFFF, 0x00000000 // WHITE & BLACK
+	config.fgColor, config.bgColor = 0xFFFFFFFF, 0x00000000     // WHITE & BLACK
+	config.fg2Color, config.blendColor = 0xFF6600FF, 0x662200FF // ORANGE & BROWN
 	config.scale, config.pixelOutlines, config.romName = 10, false, "roms/tests/1-chip8-logo.ch8"
 	config.instsPerSecond = 500
 	config.volume = 3000
-	config.currentExtension = CHIP_8
+	config.rewindSeconds, config.rewindMemory = 120, 128
+	config.seed = rand.Uint64()
+	config.traceFormat = core.DefaultTraceFormat
+	config.profilerTop = 20
+	config.goldenDir = "roms/tests/golden"
+	config.currentExtension = core.CHIP_8
+	config.quirks = core.DefaultProfile(core.CHIP_8).Quirks
 	config.colorLerpRate = 0.7
 
-	for _, arg := range os.Args[1:] {
+	// Settings are layered: the defaults above, the config file's defaults,
+	// the ROM database, the config file's sections for the ROM and finally
+	// the command line. The command line is applied first too, since it
+	// picks the config file and the ROM, and again after every layer so it
+	// always wins.
+	args := os.Args[1:]
+	config.applyArgs(args)
+
+	path, required := config.configPath, true
+	if path == "" {
+		path, required = DefaultConfigPath(), false
+	}
+	file, err := LoadConfigFile(path, required)
+	if err != nil {
+		log.Fatal(err)
+	}
+	config.applyArgs(file.Defaults())
+	config.applyArgs(args)
+
+	// An unreadable ROM is reported when it is loaded
+	data, err := core.ReadRom(config.romName)
+	if err != nil {
+		return
+	}
+	hash := sha1.Sum(data)
+
+	config.applyRomDB(hash)
+	config.applyArgs(file.RomArgs(config.romName, hash))
+	config.applyArgs(args)
+}
+
+// applyArgs sets the config from key=value arguments.
+func (config *Config) applyArgs(args []string) {
+	// Individual quirks are applied last so they override any profile
+	quirkOverrides := map[string]bool{}
+
+	for _, arg := range args {
 		parts := strings.SplitN(arg, "=", 2)
 		if len(parts) != 2 {
+			// A bare word selects a subcommand
+			config.mode = arg
 			continue
 		}
 		key, value := parts[0], parts[1]
@@ -49,6 +118,24 @@ func (config *Config) SetConfigFromArgs() {
 		switch key {
 		case "name":
 			config.romName = "roms/" + value
+		case "src":
+			config.source = value
+		case "out":
+			config.output = value
+		case "golden":
+			config.goldenDir = value
+		case "updateGolden":
+			if v, err := strconv.ParseBool(value); err == nil {
+				config.updateGolden = v
+			}
+		case "load":
+			config.loadState = value
+		case "save":
+			config.saveState = value
+		case "record":
+			config.recordMovie = value
+		case "play":
+			config.playMovie = value
 		case "scale":
 			if v, err := strconv.Atoi(value); err == nil {
 				config.scale = uint32(v)
@@ -61,12 +148,133 @@ func (config *Config) SetConfigFromArgs() {
 			if v, err := strconv.Atoi(value); err == nil {
 				config.instsPerSecond = uint32(v)
 			}
+		case "vipTiming":
+			if v, err := strconv.ParseBool(value); err == nil {
+				config.vipTiming = v
+			}
+		case "seed":
+			if v, err := strconv.ParseUint(value, 0, 64); err == nil {
+				config.seed = v
+			}
+		case "vipRandom":
+			if v, err := strconv.ParseBool(value); err == nil {
+				config.vipRandom = v
+			}
+		case "debug":
+			if v, err := strconv.ParseBool(value); err == nil {
+				config.debug = v
+			}
+		case "gdb":
+			// A bare port only listens on the local machine
+			if !strings.Contains(value, ":") {
+				value = "localhost:" + value
+			}
+			config.gdbAddr = value
+		case "trace":
+			config.tracePath = value
+		case "traceFormat":
+			config.traceFormat = value
+		case "traceFilter":
+			config.traceFilter = value
+		case "traceRing":
+			if v, err := strconv.ParseUint(value, 10, 32); err == nil {
+				config.traceRing = uint32(v)
+			}
+		case "profiler":
+			config.profilerPath = value
+		case "profilerTop":
+			if v, err := strconv.ParseUint(value, 10, 32); err == nil {
+				config.profilerTop = uint32(v)
+			}
+		case "heatmap":
+			config.heatmapPath = value
+		case "romdb":
+			config.romDBPath = value
+		case "config":
+			config.configPath = value
+		case "fgColor", "bgColor", "fg2Color", "blendColor":
+			colors := map[string]*uint32{
+				"fgColor":    &config.fgColor,
+				"bgColor":    &config.bgColor,
+				"fg2Color":   &config.fg2Color,
+				"blendColor": &config.blendColor,
+			}
+			if v, err := parseColor(value); err == nil {
+				*colors[key] = v
+			}
+		case "volume":
+			if v, err := strconv.ParseInt(value, 10, 16); err == nil && v >= 0 {
+				config.volume = int16(v)
+			}
+		case "rewindSeconds":
+			if v, err := strconv.ParseUint(value, 10, 32); err == nil {
+				config.rewindSeconds = uint32(v)
+			}
+		case "rewindMemory":
+			if v, err := strconv.ParseUint(value, 10, 32); err == nil {
+				config.rewindMemory = uint32(v)
+			}
+		case "extension":
+			if v, err := core.ParseExtension(value); err == nil {
+				config.currentExtension = v
+				config.quirks = core.DefaultProfile(v).Quirks
+			} else {
+				log.Fatal(err)
+			}
+		case "profile":
+			if p, err := core.LookupProfile(value); err == nil {
+				config.currentExtension = p.Extension
+				config.quirks = p.Quirks
+			} else {
+				log.Fatal(err)
+			}
 		case "colorLerpRate":
 			if v, err := strconv.ParseFloat(value, 32); err == nil {
 				config.colorLerpRate = float32(v)
 			}
 		default:
-			log.Fatalf("Unknown parameter: %q", key)
+			if !core.IsQuirk(key) {
+				log.Fatalf("Unknown parameter: %q", key)
+			}
+
+			if v, err := strconv.ParseBool(value); err == nil {
+				quirkOverrides[key] = v
+			}
+		}
+	}
+
+	for name, v := range quirkOverrides {
+		config.quirks.Set(name, v)
+	}
+}
+
+// applyRomDB looks the ROM with SHA-1 hash up in the built-in database and
+// the romdb= file, and applies the platform, speed, colors and keys it
+// recommends.
+func (config *Config) applyRomDB(hash [20]uint8) {
+	db := core.NewRomDB()
+	if config.romDBPath != "" {
+		if err := db.LoadFile(config.romDBPath); err != nil {
+			log.Fatal(err)
 		}
 	}
+
+	info, ok := db.Lookup(hash)
+	if !ok {
+		return
+	}
+	config.romInfo = &info
+
+	if info.Profile.Name != "" {
+		config.currentExtension = info.Profile.Extension
+		config.quirks = info.Profile.Quirks
+	}
+	if info.Tickrate > 0 {
+		config.instsPerSecond = info.Tickrate * 60
+	}
+
+	colors := []*uint32{&config.bgColor, &config.fgColor, &config.fg2Color, &config.blendColor}
+	for i, color := range info.Colors[:min(len(info.Colors), len(colors))] {
+		*colors[i] = color
+	}
 }
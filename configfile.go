@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// configFileName is the settings file looked up in the user config directory
+// when config= isn't given.
+const configFileName = "chip8-emulator/config.json"
+
+// ConfigFile holds the settings from a JSON config file, as key=value
+// arguments like the command line takes:
+//
+//	{
+//	  "defaults": {"volume": 2000, "fgColor": "#FFCC00"},
+//	  "roms": {
+//	    "Tetris [Fran Dachille, 1991].ch8": {"instsPerSecond": 900},
+//	    "5f518084744bf3cb8733f6e5454dfd1634320563": {"profile": "chip48"}
+//	  }
+//	}
+//
+// Sections under "roms" are matched by file name, path under roms/ or SHA-1.
+type ConfigFile struct {
+	defaults []string
+	roms     map[string][]string
+}
+
+// DefaultConfigPath is the config file in the user config directory, or ""
+// when the platform has none.
+func DefaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, configFileName)
+}
+
+// LoadConfigFile reads the config file at path. A missing file is only an
+// error when required, so the default path is optional.
+func LoadConfigFile(path string, required bool) (*ConfigFile, error) {
+	file := &ConfigFile{roms: map[string][]string{}}
+	if path == "" {
+		return file, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && !required {
+		return file, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var sections struct {
+		Defaults map[string]json.RawMessage            `json:"defaults"`
+		Roms     map[string]map[string]json.RawMessage `json:"roms"`
+	}
+	if err := json.Unmarshal(data, &sections); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if file.defaults, err = sectionArgs(sections.Defaults); err != nil {
+		return nil, fmt.Errorf("%s: defaults: %w", path, err)
+	}
+	for rom, section := range sections.Roms {
+		if file.roms[strings.ToLower(rom)], err = sectionArgs(section); err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", path, rom, err)
+		}
+	}
+
+	return file, nil
+}
+
+// sectionArgs turns a section into key=value arguments, sorted by key so
+// conflicting settings like profile and extension always apply in the same
+// order. Values may be strings, numbers or booleans.
+func sectionArgs(section map[string]json.RawMessage) ([]string, error) {
+	args := make([]string, 0, len(section))
+
+	for key, raw := range section {
+		var value string
+		if string(raw) == "null" {
+			return nil, fmt.Errorf("%s: expected a string, number or boolean, got null", key)
+		}
+		if err := json.Unmarshal(raw, &value); err != nil {
+			// Numbers and booleans keep their JSON spelling
+			var v any
+			if json.Unmarshal(raw, &v) != nil {
+				return nil, fmt.Errorf("%s: invalid value %s", key, raw)
+			}
+			switch v.(type) {
+			case float64, bool:
+				value = string(raw)
+			default:
+				return nil, fmt.Errorf("%s: expected a string, number or boolean, got %s", key, raw)
+			}
+		}
+		args = append(args, key+"="+value)
+	}
+	slices.Sort(args)
+
+	return args, nil
+}
+
+// Defaults returns the settings for every ROM.
+func (file *ConfigFile) Defaults() []string {
+	return file.defaults
+}
+
+// RomArgs returns the settings of the sections matching the ROM at romName
+// with SHA-1 hash: its file name, then its path under roms/, then its hash,
+// so the more specific sections win.
+func (file *ConfigFile) RomArgs(romName string, hash [20]uint8) []string {
+	var args []string
+
+	names := []string{
+		filepath.Base(romName),
+		filepath.ToSlash(strings.TrimPrefix(romName, "roms/")),
+		hex.EncodeToString(hash[:]),
+	}
+	for i, name := range names {
+		// A ROM directly in roms/ has the same file name and path
+		if slices.Contains(names[:i], name) {
+			continue
+		}
+		args = append(args, file.roms[strings.ToLower(name)]...)
+	}
+
+	return args
+}
+
+// parseColor parses an RGB or RGBA color written as hex, with an optional
+// leading '#' or 0x, e.g. "#FFCC00" or "0xFFCC00FF".
+func parseColor(s string) (uint32, error) {
+	digits := strings.TrimPrefix(strings.TrimPrefix(s, "#"), "0x")
+
+	v, err := strconv.ParseUint(digits, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid color %q", s)
+	}
+
+	switch len(digits) {
+	case 6:
+		return uint32(v)<<8 | 0xFF, nil
+	case 8:
+		return uint32(v), nil
+	default:
+		return 0, fmt.Errorf("invalid color %q", s)
+	}
+}
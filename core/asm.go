@@ -0,0 +1,718 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// AsmError is an assembly error at a 1-based source line and column.
+type AsmError struct {
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *AsmError) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Msg)
+}
+
+// AsmErrors is every error found in a source, in line order.
+type AsmErrors []*AsmError
+
+func (errs AsmErrors) Error() string {
+	lines := make([]string, len(errs))
+	for i, err := range errs {
+		lines[i] = err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// operand is one comma separated argument and where it starts in the line.
+type operand struct {
+	text   string
+	column int
+}
+
+// statement is a source line with an instruction or data directive.
+type statement struct {
+	line   int
+	column int
+	op     string // Upper case mnemonic or directive
+	args   []operand
+	addr   int
+	size   int
+}
+
+// assembler holds the state shared by both passes.
+type assembler struct {
+	extension  Extension
+	statements []*statement
+	labels     map[string]int
+	constants  map[string]operand
+	constLine  map[string]int
+	resolving  map[string]bool // Constants being evaluated, to catch cycles
+	errs       AsmErrors
+	line       int // Line of the constant or statement being evaluated
+}
+
+// Assemble translates source into a ROM image to be loaded at EntryPoint.
+//
+// Each line holds an optional "label:", then a mnemonic with comma separated
+// operands, in the syntax Disassemble prints, or a directive:
+//
+//	name = expr      define a constant (also "name equ expr")
+//	org addr         continue at addr, padding with zeros
+//	db 1, 0x20, "hi" bytes and ASCII strings
+//	dw 0x1234        big endian 16 bit words
+//	bitmap "..##.." sprite rows, '#', 'X' or '1' lit; 8 or 16 pixels wide
+//
+// Expressions are numbers (decimal, 0x hex or 0b binary), labels and
+// constants joined with + and -. Comments start with ';'. SCHIP and XO-CHIP
+// instructions are only accepted when extension supports them.
+func Assemble(source io.Reader, extension Extension) ([]uint8, error) {
+	a := &assembler{
+		extension: extension,
+		labels:    map[string]int{},
+		constants: map[string]operand{},
+		constLine: map[string]int{},
+		resolving: map[string]bool{},
+	}
+
+	addr := EntryPoint
+	scanner := bufio.NewScanner(source)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		a.line = lineNo
+		addr = a.parseLine(scanner.Text(), lineNo, addr)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	rom := make([]uint8, addr-EntryPoint)
+	for _, st := range a.statements {
+		a.line = st.line
+		a.encode(st, rom[st.addr-EntryPoint:st.addr-EntryPoint+st.size])
+	}
+
+	if len(a.errs) > 0 {
+		slices.SortStableFunc(a.errs, func(x, y *AsmError) int { return x.Line - y.Line })
+		return nil, a.errs
+	}
+
+	return rom, nil
+}
+
+func (a *assembler) errorf(column int, format string, args ...any) {
+	a.errs = append(a.errs, &AsmError{Line: a.line, Column: column, Msg: fmt.Sprintf(format, args...)})
+}
+
+// parseLine records the labels, constants and statement on one line and
+// returns the address following it.
+func (a *assembler) parseLine(text string, lineNo, addr int) int {
+	text = stripComment(text)
+	column := 1
+
+	// Leading labels
+	for {
+		trimmed := strings.TrimLeft(text, " \t")
+		column += len(text) - len(trimmed)
+		text = trimmed
+
+		name, rest, ok := strings.Cut(text, ":")
+		if !ok || !isIdentifier(name) {
+			break
+		}
+		a.define(name, column, func() { a.labels[name] = addr })
+		column += len(name) + 1
+		text = rest
+	}
+
+	if text == "" {
+		return addr
+	}
+
+	word, rest, _ := strings.Cut(text, " ")
+	word, _, _ = strings.Cut(word, "\t")
+	rest = text[len(word):]
+	restColumn := column + len(word)
+
+	// Constants: name = expr, name equ expr
+	if fields := strings.Fields(rest); len(fields) > 0 && (fields[0] == "=" || strings.EqualFold(fields[0], "equ")) {
+		if !isIdentifier(word) {
+			a.errorf(column, "invalid constant name %q", word)
+			return addr
+		}
+		offset := strings.Index(rest, fields[0]) + len(fields[0])
+		args := splitOperands(rest[offset:], restColumn+offset)
+		if len(args) != 1 {
+			a.errorf(column, "constant %s needs one value", word)
+			return addr
+		}
+		a.define(word, column, func() {
+			a.constants[word] = args[0]
+			a.constLine[word] = lineNo
+		})
+		return addr
+	}
+
+	st := &statement{
+		line:   lineNo,
+		column: column,
+		op:     strings.ToUpper(word),
+		args:   splitOperands(rest, restColumn),
+		addr:   addr,
+	}
+
+	switch st.op {
+	case "ORG":
+		if len(st.args) != 1 {
+			a.errorf(column, "org needs one address")
+			return addr
+		}
+		target, ok := a.eval(st.args[0])
+		if !ok {
+			return addr
+		}
+		if target < addr {
+			a.errorf(st.args[0].column, "org 0x%03X is behind the current address 0x%03X", target, addr)
+			return addr
+		}
+		if target >= a.extension.memorySize() {
+			a.errorf(st.args[0].column, "org 0x%03X is past the end of memory at 0x%03X", target, a.extension.memorySize()-1)
+			return addr
+		}
+		st.size = target - addr
+	case "DB":
+		for _, arg := range st.args {
+			if s, ok := unquote(arg.text); ok {
+				st.size += len(s)
+			} else {
+				st.size++
+			}
+		}
+	case "DW":
+		st.size = 2 * len(st.args)
+	case "BITMAP":
+		for _, arg := range st.args {
+			s, ok := unquote(arg.text)
+			if !ok || (len(s) != 8 && len(s) != 16) {
+				a.errorf(arg.column, "bitmap rows must be quoted and 8 or 16 pixels wide")
+				continue
+			}
+			st.size += len(s) / 8
+		}
+	case "LD":
+		st.size = 2
+		if len(st.args) == 2 && strings.HasPrefix(strings.ToUpper(st.args[1].text), "LONG ") {
+			st.size = 4
+		}
+	default:
+		st.size = 2
+	}
+
+	if st.op != "ORG" && addr+st.size > a.extension.memorySize() {
+		a.errorf(column, "%s at 0x%03X runs past the end of memory at 0x%03X", word, addr, a.extension.memorySize()-1)
+		return addr
+	}
+
+	a.statements = append(a.statements, st)
+
+	return addr + st.size
+}
+
+// define runs add unless name is already a label or constant.
+func (a *assembler) define(name string, column int, add func()) {
+	_, isLabel := a.labels[name]
+	_, isConst := a.constants[name]
+	if isLabel || isConst {
+		a.errorf(column, "%s is already defined", name)
+		return
+	}
+	if _, ok := parseRegister(name); ok || isReserved(name) {
+		a.errorf(column, "%s is a reserved name", name)
+		return
+	}
+	add()
+}
+
+// encode writes the bytes for st into out, which is st.size long.
+func (a *assembler) encode(st *statement, out []uint8) {
+	switch st.op {
+	case "ORG":
+		return
+	case "DB":
+		i := 0
+		for _, arg := range st.args {
+			if s, ok := unquote(arg.text); ok {
+				i += copy(out[i:], s)
+				continue
+			}
+			if v, ok := a.value(arg, -128, 0xFF); ok {
+				out[i] = uint8(v)
+			}
+			i++
+		}
+		return
+	case "DW":
+		for i, arg := range st.args {
+			if v, ok := a.value(arg, -0x8000, 0xFFFF); ok {
+				out[2*i], out[2*i+1] = uint8(v>>8), uint8(v)
+			}
+		}
+		return
+	case "BITMAP":
+		i := 0
+		for _, arg := range st.args {
+			s, ok := unquote(arg.text)
+			if !ok || (len(s) != 8 && len(s) != 16) {
+				continue
+			}
+			for col, c := range []byte(s) {
+				switch c {
+				case '#', 'X', 'x', '1':
+					out[i+col/8] |= 0x80 >> (col % 8)
+				case '.', ' ', '0', '_':
+				default:
+					a.errorf(arg.column+1+col, "invalid bitmap pixel %q", c)
+				}
+			}
+			i += len(s) / 8
+		}
+		return
+	}
+
+	opcode, long, ok := a.instruction(st)
+	if !ok {
+		return
+	}
+	out[0], out[1] = uint8(opcode>>8), uint8(opcode)
+	if st.size == 4 {
+		out[2], out[3] = uint8(long>>8), uint8(long)
+	}
+}
+
+// instruction encodes an instruction statement. long is the second word of
+// XO-CHIP's 4 byte F000 NNNN.
+func (a *assembler) instruction(st *statement) (opcode uint16, long uint16, ok bool) {
+	args := st.args
+	schip := a.extension != CHIP_8
+	xochip := a.extension == XOCHIP
+
+	want := func(n int) bool {
+		if len(args) != n {
+			a.errorf(st.column, "%s takes %d operands, got %d", st.op, n, len(args))
+			return false
+		}
+		return true
+	}
+	needs := func(supported bool, ext Extension) bool {
+		if !supported {
+			a.errorf(st.column, "%s needs extension=%s", st.op, ext)
+		}
+		return supported
+	}
+	reg := func(arg operand) (uint16, bool) {
+		r, ok := parseRegister(arg.text)
+		if !ok {
+			a.errorf(arg.column, "expected a V register, got %q", arg.text)
+		}
+		return uint16(r), ok
+	}
+	keyword := func(arg operand, word string) bool {
+		return strings.EqualFold(arg.text, word)
+	}
+	isReg := func(arg operand) bool {
+		_, ok := parseRegister(arg.text)
+		return ok
+	}
+	// regReg encodes base | X<<8 | Y<<4
+	regReg := func(base uint16) (uint16, uint16, bool) {
+		x, ok1 := reg(args[0])
+		y, ok2 := reg(args[1])
+		return base | x<<8 | y<<4, 0, ok1 && ok2
+	}
+	// regImm encodes base | X<<8 | NN
+	regImm := func(base uint16) (uint16, uint16, bool) {
+		x, ok1 := reg(args[0])
+		nn, ok2 := a.value(args[1], -128, 0xFF)
+		return base | x<<8 | uint16(nn)&0xFF, 0, ok1 && ok2
+	}
+	// fx encodes 0xF0NN with X from arg
+	fx := func(nn uint16, arg operand) (uint16, uint16, bool) {
+		x, ok := reg(arg)
+		return 0xF000 | x<<8 | nn, 0, ok
+	}
+	addr := func(base uint16, arg operand) (uint16, uint16, bool) {
+		v, ok := a.value(arg, 0, 0xFFF)
+		return base | uint16(v), 0, ok
+	}
+
+	switch st.op {
+	case "CLS":
+		return 0x00E0, 0, want(0)
+	case "RET":
+		return 0x00EE, 0, want(0)
+	case "SCR", "SCL", "EXIT", "LOW", "HIGH":
+		codes := map[string]uint16{"SCR": 0x00FB, "SCL": 0x00FC, "EXIT": 0x00FD, "LOW": 0x00FE, "HIGH": 0x00FF}
+		return codes[st.op], 0, want(0) && needs(schip, SUPERCHIP)
+	case "SCD", "SCU":
+		if !want(1) {
+			return 0, 0, false
+		}
+		base := uint16(0x00C0)
+		if st.op == "SCU" {
+			if !needs(xochip, XOCHIP) {
+				return 0, 0, false
+			}
+			base = 0x00D0
+		} else if !needs(schip, SUPERCHIP) {
+			return 0, 0, false
+		}
+		n, ok := a.value(args[0], 0, 0xF)
+		return base | uint16(n), 0, ok
+	case "JP":
+		if len(args) == 2 && keyword(args[0], "V0") {
+			return addr(0xB000, args[1])
+		}
+		// BXNN as the jumping quirk reads it: X is the high nibble of the target
+		if len(args) == 2 && isReg(args[0]) {
+			x, _ := reg(args[0])
+			opcode, _, ok := addr(0xB000, args[1])
+			if ok && opcode>>8&0xF != x {
+				a.errorf(args[1].column, "JP V%X needs a target in 0x%X00-0x%XFF", x, x, x)
+				return 0, 0, false
+			}
+			return opcode, 0, ok
+		}
+		if !want(1) {
+			return 0, 0, false
+		}
+		return addr(0x1000, args[0])
+	case "CALL":
+		if !want(1) {
+			return 0, 0, false
+		}
+		return addr(0x2000, args[0])
+	case "SE", "SNE":
+		if !want(2) {
+			return 0, 0, false
+		}
+		if isReg(args[1]) {
+			if st.op == "SE" {
+				return regReg(0x5000)
+			}
+			return regReg(0x9000)
+		}
+		if st.op == "SE" {
+			return regImm(0x3000)
+		}
+		return regImm(0x4000)
+	case "SAVE", "LOAD":
+		if !want(2) || !needs(xochip, XOCHIP) {
+			return 0, 0, false
+		}
+		if st.op == "SAVE" {
+			return regReg(0x5002)
+		}
+		return regReg(0x5003)
+	case "OR", "AND", "XOR", "SUB", "SUBN":
+		if !want(2) {
+			return 0, 0, false
+		}
+		codes := map[string]uint16{"OR": 0x8001, "AND": 0x8002, "XOR": 0x8003, "SUB": 0x8005, "SUBN": 0x8007}
+		return regReg(codes[st.op])
+	case "SHR", "SHL":
+		// The one operand form shifts VX in place
+		if len(args) == 1 {
+			args = append(args, args[0])
+		}
+		if !want(2) {
+			return 0, 0, false
+		}
+		if st.op == "SHR" {
+			return regReg(0x8006)
+		}
+		return regReg(0x800E)
+	case "RND":
+		if !want(2) {
+			return 0, 0, false
+		}
+		return regImm(0xC000)
+	case "DRW":
+		if !want(3) {
+			return 0, 0, false
+		}
+		opcode, _, ok := regReg(0xD000)
+		n, okN := a.value(args[2], 0, 0xF)
+		return opcode | uint16(n), 0, ok && okN
+	case "SKP", "SKNP":
+		if !want(1) {
+			return 0, 0, false
+		}
+		x, ok := reg(args[0])
+		if st.op == "SKP" {
+			return 0xE09E | x<<8, 0, ok
+		}
+		return 0xE0A1 | x<<8, 0, ok
+	case "PLANE":
+		if !want(1) || !needs(xochip, XOCHIP) {
+			return 0, 0, false
+		}
+		n, ok := a.value(args[0], 0, 3)
+		return 0xF001 | uint16(n)<<8, 0, ok
+	case "AUDIO":
+		return 0xF002, 0, want(0) && needs(xochip, XOCHIP)
+	case "PITCH":
+		if !want(1) || !needs(xochip, XOCHIP) {
+			return 0, 0, false
+		}
+		return fx(0x3A, args[0])
+	case "ADD":
+		if !want(2) {
+			return 0, 0, false
+		}
+		switch {
+		case keyword(args[0], "I"):
+			return fx(0x1E, args[1])
+		case isReg(args[1]):
+			return regReg(0x8004)
+		default:
+			return regImm(0x7000)
+		}
+	case "LD":
+		if !want(2) {
+			return 0, 0, false
+		}
+		dst, src := args[0], args[1]
+		switch {
+		case keyword(dst, "I") && strings.HasPrefix(strings.ToUpper(src.text), "LONG "):
+			if !needs(xochip, XOCHIP) {
+				return 0, 0, false
+			}
+			skip := len(src.text) - len(strings.TrimLeft(src.text[5:], " \t"))
+			v, ok := a.value(operand{src.text[skip:], src.column + skip}, 0, 0xFFFF)
+			return 0xF000, uint16(v), ok
+		case keyword(dst, "I"):
+			return addr(0xA000, src)
+		case keyword(dst, "DT"):
+			return fx(0x15, src)
+		case keyword(dst, "ST"):
+			return fx(0x18, src)
+		case keyword(dst, "F"):
+			return fx(0x29, src)
+		case keyword(dst, "HF"):
+			if !needs(schip, SUPERCHIP) {
+				return 0, 0, false
+			}
+			return fx(0x30, src)
+		case keyword(dst, "B"):
+			return fx(0x33, src)
+		case keyword(dst, "[I]"):
+			return fx(0x55, src)
+		case keyword(dst, "R"):
+			if !needs(schip, SUPERCHIP) {
+				return 0, 0, false
+			}
+			return fx(0x75, src)
+		case keyword(src, "DT"):
+			return fx(0x07, dst)
+		case keyword(src, "K"):
+			return fx(0x0A, dst)
+		case keyword(src, "[I]"):
+			return fx(0x65, dst)
+		case keyword(src, "R"):
+			if !needs(schip, SUPERCHIP) {
+				return 0, 0, false
+			}
+			return fx(0x85, dst)
+		case isReg(src):
+			return regReg(0x8000)
+		default:
+			return regImm(0x6000)
+		}
+	}
+
+	a.errorf(st.column, "unknown instruction %q", st.op)
+	return 0, 0, false
+}
+
+// value evaluates arg and checks it lies within [lo, hi].
+func (a *assembler) value(arg operand, lo, hi int) (int, bool) {
+	v, ok := a.eval(arg)
+	if !ok {
+		return 0, false
+	}
+	if v < lo || v > hi {
+		a.errorf(arg.column, "value %d out of range %d to %d", v, lo, hi)
+		return 0, false
+	}
+	return v, true
+}
+
+// eval evaluates an expression of numbers and symbols joined by + and -.
+func (a *assembler) eval(arg operand) (int, bool) {
+	text := arg.text
+	isSpace := func(i int) bool { return i < len(text) && (text[i] == ' ' || text[i] == '\t') }
+
+	total, i := 0, 0
+	for first := true; ; first = false {
+		for isSpace(i) {
+			i++
+		}
+
+		// The sign is optional on the first term only
+		sign := 1
+		if i < len(text) && (text[i] == '+' || text[i] == '-') {
+			if text[i] == '-' {
+				sign = -1
+			}
+			i++
+			for isSpace(i) {
+				i++
+			}
+		} else if !first {
+			a.errorf(arg.column+i, "expected + or - before %q", text[i:])
+			return 0, false
+		}
+
+		start := i
+		for i < len(text) && text[i] != '+' && text[i] != '-' && !isSpace(i) {
+			i++
+		}
+		v, ok := a.term(text[start:i], arg.column+start)
+		if !ok {
+			return 0, false
+		}
+		total += sign * v
+
+		for isSpace(i) {
+			i++
+		}
+		if i >= len(text) {
+			return total, true
+		}
+	}
+}
+
+// term evaluates a single number or symbol.
+func (a *assembler) term(text string, column int) (int, bool) {
+	if text == "" {
+		a.errorf(column, "missing value")
+		return 0, false
+	}
+
+	if text[0] >= '0' && text[0] <= '9' {
+		v, err := strconv.ParseInt(strings.ReplaceAll(text, "_", ""), 0, 32)
+		if err != nil {
+			a.errorf(column, "invalid number %q", text)
+			return 0, false
+		}
+		return int(v), true
+	}
+
+	if addr, ok := a.labels[text]; ok {
+		return addr, true
+	}
+
+	if expr, ok := a.constants[text]; ok {
+		if a.resolving[text] {
+			a.errorf(column, "constant %s refers to itself", text)
+			return 0, false
+		}
+		a.resolving[text] = true
+		line := a.line
+		a.line = a.constLine[text]
+		v, ok := a.eval(expr)
+		a.line = line
+		delete(a.resolving, text)
+		return v, ok
+	}
+
+	a.errorf(column, "undefined symbol %q", text)
+	return 0, false
+}
+
+// stripComment removes a ';' comment outside of quotes.
+func stripComment(text string) string {
+	quoted := false
+	for i, c := range text {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == ';' && !quoted:
+			return text[:i]
+		}
+	}
+	return text
+}
+
+// splitOperands splits text on commas outside of quotes, keeping the column
+// each operand starts at. column is the column of text[0].
+func splitOperands(text string, column int) []operand {
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+
+	var args []operand
+	quoted := false
+	start := 0
+	for i := 0; i <= len(text); i++ {
+		if i < len(text) && text[i] == '"' {
+			quoted = !quoted
+		}
+		if i < len(text) && (text[i] != ',' || quoted) {
+			continue
+		}
+		raw := text[start:i]
+		trimmed := strings.TrimLeft(raw, " \t")
+		args = append(args, operand{
+			text:   strings.TrimRight(trimmed, " \t"),
+			column: column + start + len(raw) - len(trimmed),
+		})
+		start = i + 1
+	}
+
+	return args
+}
+
+func unquote(text string) (string, bool) {
+	if len(text) < 2 || text[0] != '"' || text[len(text)-1] != '"' {
+		return "", false
+	}
+	return text[1 : len(text)-1], true
+}
+
+func isIdentifier(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		letter := c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+		digit := c >= '0' && c <= '9'
+		if !letter && !(i > 0 && (digit || c == '.')) {
+			return false
+		}
+	}
+	return true
+}
+
+func parseRegister(text string) (uint8, bool) {
+	if len(text) != 2 || (text[0] != 'V' && text[0] != 'v') {
+		return 0, false
+	}
+	r, err := strconv.ParseUint(text[1:], 16, 4)
+	return uint8(r), err == nil
+}
+
+// isReserved reports whether name is an operand keyword such as I or DT.
+func isReserved(name string) bool {
+	switch strings.ToUpper(name) {
+	case "I", "DT", "ST", "K", "F", "HF", "B", "R", "LONG":
+		return true
+	}
+	return false
+}
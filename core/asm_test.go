@@ -0,0 +1,215 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// asmTest assembles source for extension and compares the ROM with want, or
+// checks that it fails with err at line:column.
+type asmTest struct {
+	name      string
+	extension Extension
+	source    string
+	want      []uint8
+	err       string // "line:column: message" prefix of the first error
+}
+
+var asmTests = []asmTest{
+	// Encoding
+	{name: "CLS", source: "CLS", want: []uint8{0x00, 0xE0}},
+	{name: "RET", source: "RET", want: []uint8{0x00, 0xEE}},
+	{name: "JP", source: "JP 0x345", want: []uint8{0x13, 0x45}},
+	{name: "JP V0", source: "JP V0, 0x345", want: []uint8{0xB3, 0x45}},
+	{name: "JP VX", source: "JP V3, 0x345", want: []uint8{0xB3, 0x45}},
+	{name: "CALL", source: "CALL 0x345", want: []uint8{0x23, 0x45}},
+	{name: "SE byte", source: "SE V3, 0x45", want: []uint8{0x33, 0x45}},
+	{name: "SNE byte", source: "SNE V3, 0x45", want: []uint8{0x43, 0x45}},
+	{name: "SE register", source: "SE V3, V4", want: []uint8{0x53, 0x40}},
+	{name: "SNE register", source: "SNE V3, V4", want: []uint8{0x93, 0x40}},
+	{name: "LD byte", source: "LD V3, 0x45", want: []uint8{0x63, 0x45}},
+	{name: "LD negative byte", source: "LD V3, -1", want: []uint8{0x63, 0xFF}},
+	{name: "ADD byte", source: "ADD V3, 0x45", want: []uint8{0x73, 0x45}},
+	{name: "LD register", source: "LD V3, V4", want: []uint8{0x83, 0x40}},
+	{name: "OR", source: "OR V3, V4", want: []uint8{0x83, 0x41}},
+	{name: "AND", source: "AND V3, V4", want: []uint8{0x83, 0x42}},
+	{name: "XOR", source: "XOR V3, V4", want: []uint8{0x83, 0x43}},
+	{name: "ADD register", source: "ADD V3, V4", want: []uint8{0x83, 0x44}},
+	{name: "SUB", source: "SUB V3, V4", want: []uint8{0x83, 0x45}},
+	{name: "SHR", source: "SHR V3, V4", want: []uint8{0x83, 0x46}},
+	{name: "SHR in place", source: "SHR V3", want: []uint8{0x83, 0x36}},
+	{name: "SUBN", source: "SUBN V3, V4", want: []uint8{0x83, 0x47}},
+	{name: "SHL", source: "SHL V3, V4", want: []uint8{0x83, 0x4E}},
+	{name: "LD I", source: "LD I, 0x345", want: []uint8{0xA3, 0x45}},
+	{name: "RND", source: "RND V3, 0x45", want: []uint8{0xC3, 0x45}},
+	{name: "DRW", source: "DRW V3, V4, 5", want: []uint8{0xD3, 0x45}},
+	{name: "SKP", source: "SKP V3", want: []uint8{0xE3, 0x9E}},
+	{name: "SKNP", source: "SKNP V3", want: []uint8{0xE3, 0xA1}},
+	{name: "LD from DT", source: "LD V3, DT", want: []uint8{0xF3, 0x07}},
+	{name: "LD K", source: "LD V3, K", want: []uint8{0xF3, 0x0A}},
+	{name: "LD DT", source: "LD DT, V3", want: []uint8{0xF3, 0x15}},
+	{name: "LD ST", source: "LD ST, V3", want: []uint8{0xF3, 0x18}},
+	{name: "ADD I", source: "ADD I, V3", want: []uint8{0xF3, 0x1E}},
+	{name: "LD F", source: "LD F, V3", want: []uint8{0xF3, 0x29}},
+	{name: "LD B", source: "LD B, V3", want: []uint8{0xF3, 0x33}},
+	{name: "LD [I]", source: "LD [I], V3", want: []uint8{0xF3, 0x55}},
+	{name: "LD from [I]", source: "LD V3, [I]", want: []uint8{0xF3, 0x65}},
+	{name: "mnemonics ignore case", source: "ld v3, 0x45", want: []uint8{0x63, 0x45}},
+	{name: "SCD", extension: SUPERCHIP, source: "SCD 4", want: []uint8{0x00, 0xC4}},
+	{name: "SCR", extension: SUPERCHIP, source: "SCR", want: []uint8{0x00, 0xFB}},
+	{name: "SCL", extension: SUPERCHIP, source: "SCL", want: []uint8{0x00, 0xFC}},
+	{name: "EXIT", extension: SUPERCHIP, source: "EXIT", want: []uint8{0x00, 0xFD}},
+	{name: "LOW", extension: SUPERCHIP, source: "LOW", want: []uint8{0x00, 0xFE}},
+	{name: "HIGH", extension: SUPERCHIP, source: "HIGH", want: []uint8{0x00, 0xFF}},
+	{name: "LD HF", extension: SUPERCHIP, source: "LD HF, V3", want: []uint8{0xF3, 0x30}},
+	{name: "LD R", extension: SUPERCHIP, source: "LD R, V3", want: []uint8{0xF3, 0x75}},
+	{name: "LD from R", extension: SUPERCHIP, source: "LD V3, R", want: []uint8{0xF3, 0x85}},
+	{name: "SCU", extension: XOCHIP, source: "SCU 4", want: []uint8{0x00, 0xD4}},
+	{name: "SAVE", extension: XOCHIP, source: "SAVE V3, V4", want: []uint8{0x53, 0x42}},
+	{name: "LOAD", extension: XOCHIP, source: "LOAD V3, V4", want: []uint8{0x53, 0x43}},
+	{name: "LD I long", extension: XOCHIP, source: "LD I, long 0x1234", want: []uint8{0xF0, 0x00, 0x12, 0x34}},
+	{name: "PLANE", extension: XOCHIP, source: "PLANE 3", want: []uint8{0xF3, 0x01}},
+	{name: "AUDIO", extension: XOCHIP, source: "AUDIO", want: []uint8{0xF0, 0x02}},
+	{name: "PITCH", extension: XOCHIP, source: "PITCH V3", want: []uint8{0xF3, 0x3A}},
+
+	// Data
+	{name: "db", source: `db 1, 0x20, -1, "hi"`, want: []uint8{0x01, 0x20, 0xFF, 'h', 'i'}},
+	{name: "dw", source: "dw 0x1234, 5", want: []uint8{0x12, 0x34, 0x00, 0x05}},
+	{name: "bitmap", source: `bitmap "#......#", "X.1.....________"`, want: []uint8{0x81, 0xA0, 0x00}},
+
+	// Labels and constants
+	{
+		name:   "label forward reference",
+		source: "JP end\nCALL sub\nsub: RET\nend: JP end",
+		want:   []uint8{0x12, 0x06, 0x22, 0x04, 0x00, 0xEE, 0x12, 0x06},
+	},
+	{
+		name:   "label backward reference",
+		source: "start:\nloop: ADD V0, 1\nJP loop",
+		want:   []uint8{0x70, 0x01, 0x12, 0x00},
+	},
+	{
+		name:   "constants and expressions",
+		source: "SPEED = 3\nTOP equ SPEED + 1\nLD V0, TOP - 2\nLD I, data + 1\ndata: db 0",
+		want:   []uint8{0x60, 0x02, 0xA2, 0x05, 0x00},
+	},
+	{
+		name:   "constant defined after use",
+		source: "LD V0, LATER\nLATER = 7",
+		want:   []uint8{0x60, 0x07},
+	},
+
+	// org
+	{
+		name:   "org pads with zeros",
+		source: "CLS\norg 0x206\nRET",
+		want:   []uint8{0x00, 0xE0, 0x00, 0x00, 0x00, 0x00, 0x00, 0xEE},
+	},
+	{
+		name:   "org at the current address",
+		source: "CLS\norg 0x202\nRET",
+		want:   []uint8{0x00, 0xE0, 0x00, 0xEE},
+	},
+	{
+		name:   "org moves labels",
+		source: "JP sprite\norg 0x300\nsprite: db 0xFF",
+		want:   append(append([]uint8{0x13, 0x00}, make([]uint8, 0x300-0x202)...), 0xFF),
+	},
+	{name: "org behind the current address", source: "CLS\nCLS\norg 0x202", err: "3:5: org 0x202 is behind"},
+	{name: "org past CHIP-8 memory", source: "org 0x1000", err: "1:5: org 0x1000 is past the end of memory at 0xFFF"},
+	{name: "org past SCHIP memory", extension: SUPERCHIP, source: "org 0x1000", err: "1:5: org 0x1000 is past the end of memory"},
+	{name: "org past XO-CHIP memory", extension: XOCHIP, source: "org 0x10000", err: "1:5: org 0x10000 is past the end of memory at 0xFFFF"},
+	{name: "org far past memory", source: "org 0x7FFFFFFF", err: "1:5: org 0x7FFFFFFF is past the end of memory"},
+	{name: "org needs an address", source: "org", err: "1:1: org needs one address"},
+	{name: "org to an undefined label", source: "org nowhere", err: `1:5: undefined symbol "nowhere"`},
+	{name: "code runs past memory", source: "org 0xFFE\nCLS\nCLS", err: "3:1: CLS at 0x1000 runs past the end of memory at 0xFFF"},
+	{name: "data runs past memory", source: "org 0xFFE\ndw 1, 2", err: "2:1: dw at 0xFFE runs past the end of memory"},
+	{
+		name:      "XO-CHIP fits beyond 4 KiB",
+		extension: XOCHIP,
+		source:    "LD I, long end\norg 0x1000\nend: CLS",
+		want:      append(append([]uint8{0xF0, 0x00, 0x10, 0x00}, make([]uint8, 0x1000-0x204)...), 0x00, 0xE0),
+	},
+
+	// Errors
+	{name: "unknown instruction", source: "  FOO V1", err: `1:3: unknown instruction "FOO"`},
+	{name: "operand count", source: "CLS V1", err: "1:1: CLS takes 0 operands, got 1"},
+	{name: "not a register", source: "SKP 5", err: `1:5: expected a V register, got "5"`},
+	{name: "byte out of range", source: "LD V0, 256", err: "1:8: value 256 out of range -128 to 255"},
+	{name: "address out of range", source: "JP 0x1000", err: "1:4: value 4096 out of range 0 to 4095"},
+	{name: "JP VX target", source: "JP V3, 0x445", err: "1:8: JP V3 needs a target in 0x300-0x3FF"},
+	{name: "undefined label", source: "JP nowhere", err: `1:4: undefined symbol "nowhere"`},
+	{name: "duplicate label", source: "a: CLS\na: CLS", err: "2:1: a is already defined"},
+	{name: "register as a label", source: "V1: CLS", err: "1:1: V1 is a reserved name"},
+	{name: "recursive constant", source: "FOO = BAR\nBAR = FOO\nLD V0, FOO", err: "2:7: constant FOO refers to itself"},
+	{name: "SCHIP instruction on CHIP-8", source: "HIGH", err: "1:1: HIGH needs extension=schip"},
+	{name: "XO-CHIP instruction on SCHIP", extension: SUPERCHIP, source: "PLANE 1", err: "1:1: PLANE needs extension=xochip"},
+	{name: "bitmap width", source: `bitmap "###"`, err: "1:8: bitmap rows must be quoted"},
+}
+
+func TestAssemble(t *testing.T) {
+	for _, test := range asmTests {
+		t.Run(test.name, func(t *testing.T) {
+			rom, err := Assemble(strings.NewReader(test.source), test.extension)
+
+			if test.err != "" {
+				var errs AsmErrors
+				if !errors.As(err, &errs) {
+					t.Fatalf("got error %v, want %q", err, test.err)
+				}
+				if got := errs[0].Error(); !strings.HasPrefix(got, test.err) {
+					t.Errorf("got error %q, want %q", got, test.err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(rom, test.want) {
+				t.Errorf("got % X, want % X", rom, test.want)
+			}
+		})
+	}
+}
+
+// TestAssembleDisassembleRoundTrip assembles the mnemonic of every valid
+// opcode, with and without the jumping quirk, and expects the same opcode back.
+func TestAssembleDisassembleRoundTrip(t *testing.T) {
+	for _, extension := range []Extension{CHIP_8, SUPERCHIP, XOCHIP} {
+		for opcode := range 0x10000 {
+			code := []uint8{uint8(opcode >> 8), uint8(opcode), 0x12, 0x34}
+			for _, quirks := range []Quirks{{}, {Jumping: true}} {
+				text, size, ok := Mnemonic(code, extension, quirks)
+				if !ok {
+					continue
+				}
+
+				rom, err := Assemble(strings.NewReader(text), extension)
+				if err != nil {
+					t.Errorf("%v: %04X %q: %v", extension, opcode, text, err)
+					continue
+				}
+				if !bytes.Equal(rom, code[:size]) {
+					t.Errorf("%v: %04X %q assembled to % X", extension, opcode, text, rom)
+				}
+			}
+		}
+	}
+}
+
+func TestMnemonicJumping(t *testing.T) {
+	code := []uint8{0xB3, 0x45}
+	for _, test := range []struct {
+		quirks Quirks
+		want   string
+	}{
+		{Quirks{}, "JP V0, 0x345"},
+		{Quirks{Jumping: true}, "JP V3, 0x345"},
+	} {
+		text, _, _ := Mnemonic(code, SUPERCHIP, test.quirks)
+		expect(t, "mnemonic", text, test.want)
+	}
+}
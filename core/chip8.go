@@ -0,0 +1,844 @@
+// Package core implements the CHIP-8 virtual machine: memory, registers,
+// fetch/decode/execute and timers. It has no SDL dependency so it can be
+// embedded in other tools or run headless.
+package core
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type EmulatorState int
+
+const (
+	QUIT EmulatorState = iota
+	RUNNING
+	PAUSED
+	FAULTED // Stopped by a runtime fault, see CHIP8.Fault
+)
+
+type Extension int
+
+const (
+	CHIP_8 Extension = iota
+	SUPERCHIP
+	XOCHIP
+)
+
+var extensionNames = map[Extension]string{
+	CHIP_8:    "chip8",
+	SUPERCHIP: "schip",
+	XOCHIP:    "xochip",
+}
+
+func (e Extension) String() string {
+	if name, ok := extensionNames[e]; ok {
+		return name
+	}
+	return fmt.Sprintf("Extension(%d)", int(e))
+}
+
+// ParseExtension maps a platform name such as "schip" to its Extension.
+func ParseExtension(name string) (Extension, error) {
+	for e, n := range extensionNames {
+		if n == strings.ToLower(name) {
+			return e, nil
+		}
+	}
+	return CHIP_8, fmt.Errorf("unknown extension %q", name)
+}
+
+const (
+	DisplayWidth  = 64  // Original CHIP8 horizontal resolution
+	DisplayHeight = 32  // Original CHIP8 vertical resolution
+	HiresWidth    = 128 // SCHIP high resolution mode
+	HiresHeight   = 64
+)
+
+// EntryPoint is where ROMs are loaded and execution starts.
+const EntryPoint = 0x200
+
+const (
+	fontAddress    = 0x000 // 4x5 hex digits, 5 bytes each
+	bigFontAddress = 0x050 // SCHIP 8x10 hex digits, 10 bytes each
+)
+
+const (
+	chip8MemorySize  = 0x1000  // 4 KiB on CHIP8 and SCHIP
+	xochipMemorySize = 0x10000 // 64 KiB on XO-CHIP
+)
+
+type Instruction struct {
+	opcode uint16
+	NNN    uint16 // 12 bit address/constant
+	NN     uint8  // 8 bit constant
+	N      uint8  // 4 bit constant
+	X      uint8  // 4 bit register identifier
+	Y      uint8  // 4 bit register identifier
+}
+
+// decode splits opcode into its operand fields.
+func decode(opcode uint16) Instruction {
+	return Instruction{
+		opcode: opcode,
+		NNN:    opcode & 0x0FFF,
+		NN:     uint8(opcode) & 0x0FF,
+		N:      uint8(opcode) & 0x0F,
+		X:      uint8((opcode & 0x0F00) >> 8),
+		Y:      uint8((opcode & 0x00F0) >> 4),
+	}
+}
+
+type CHIP8 struct {
+	state        EmulatorState
+	ram          [xochipMemorySize]uint8
+	entryPoint   uint32
+	display      [HiresWidth * HiresHeight]uint8 // Pixel bitplanes, row stride is the current resolution width
+	hires        bool                            // SCHIP 128x64 mode enabled
+	planes       uint8                           // XO-CHIP bitplanes selected for drawing
+	stack        [16]uint16                      // Subroutine stack
+	stackPointer uint8                           // Stack pointer
+	V            [16]uint8                       // Data registers V0-VF
+	I            uint16                          // Index register
+	PC           uint16                          // Program counter
+	delayTimer   uint8                           // Decrements at 60hz when > 0
+	soundTimer   uint8                           // Decrements at 60hz and plays tone when > 0
+	keypad       [16]bool                        // Hexadecimal keypad 0x0-0xF
+	keyHeld      bool                            // FX0A saw heldKey pressed and waits for its release
+	heldKey      uint8                           // Key FX0A is waiting on
+	rpl          [16]uint8                       // SCHIP RPL user flags, survive Reset
+	romName      string                          // Currently running ROM
+	rom          []uint8                         // Raw ROM image, kept for Reset
+	romHash      [20]uint8                       // SHA-1 of rom
+	inst         Instruction                     // Currently executing instruction
+	instPC       uint16                          // Address of the currently executing instruction
+	fault        *Fault                          // Fault that stopped the machine, if any
+	seed         uint64                          // CXNN random seed, reapplied on Reset
+	random       Random                          // CXNN random source
+	breakpoints  map[uint16]bool                 // Addresses RunFrame stops in front of
+	breakWhen    func() bool                     // One-shot break condition, checked before each instruction
+	resume       bool                            // Run the next instruction even if it is a breakpoint
+	watchpoints  []Watchpoint                    // Memory and register accesses that stop execution
+	watchHit     *WatchHit                       // First watchpoint hit by the current instruction
+	trace        *Trace                          // Instruction trace log, if enabled
+	profiler     *Profiler                       // Execution counts, if enabled
+	extension    Extension                       // Active platform
+	quirks       Quirks                          // Active interpreter quirks
+	vblankWait   bool                            // DXYN hit the display wait quirk, idle until the next frame
+	cycleDebt    int                             // VIP machine cycles overspent in the previous frame, <= 0
+	beeping      bool
+	audioPattern [16]uint8 // XO-CHIP 1-bit audio sample buffer
+	hasPattern   bool      // Audio pattern loaded with F002, otherwise play the default tone
+	pitch        uint8     // XO-CHIP playback rate register
+}
+
+// Init loads the font and the ROM at romName and leaves the machine RUNNING.
+func (chip8 *CHIP8) Init(romName string, extension Extension, quirks Quirks) error {
+	data, err := ReadRom(romName)
+	if err != nil {
+		return err
+	}
+
+	chip8.InitData(romName, data, extension, quirks)
+
+	return nil
+}
+
+// InitData is like Init but takes an in-memory ROM image.
+func (chip8 *CHIP8) InitData(romName string, data []uint8, extension Extension, quirks Quirks) {
+	chip8.entryPoint = EntryPoint
+	chip8.romName = romName
+	chip8.rom = data
+	chip8.romHash = sha1.Sum(data)
+	chip8.extension = extension
+	chip8.quirks = quirks
+	if chip8.random == nil {
+		chip8.random = NewPCGRandom(chip8.seed)
+	}
+
+	chip8.Reset()
+}
+
+// Reset clears the machine and reloads the font and current ROM.
+func (chip8 *CHIP8) Reset() {
+	for i := range chip8.ram {
+		chip8.ram[i] = 0
+	}
+
+	for i := range chip8.V {
+		chip8.V[i] = 0
+	}
+	chip8.I = 0
+	chip8.PC = uint16(chip8.entryPoint)
+	chip8.stackPointer = 0
+	for i := range chip8.stack {
+		chip8.stack[i] = 0
+	}
+
+	chip8.hires = false
+	chip8.planes = 0x1
+	chip8.display = [HiresWidth * HiresHeight]uint8{}
+
+	for i := range chip8.keypad {
+		chip8.keypad[i] = false
+	}
+	chip8.keyHeld, chip8.heldKey = false, 0
+
+	chip8.delayTimer = 0
+	chip8.soundTimer = 0
+	chip8.beeping = false
+	chip8.cycleDebt = 0
+	chip8.fault = nil
+	chip8.random.Seed(chip8.seed)
+	chip8.audioPattern = [16]uint8{}
+	chip8.hasPattern = false
+	chip8.pitch = 64
+
+	chip8.LoadFont()
+	chip8.LoadRom(chip8.rom, chip8.entryPoint)
+
+	chip8.state = RUNNING
+}
+
+func (chip8 *CHIP8) LoadFont() {
+	font := [...]uint8{
+		0xF0, 0x90, 0x90, 0x90, 0xF0, // 0
+		0x20, 0x60, 0x20, 0x20, 0x70, // 1
+		0xF0, 0x10, 0xF0, 0x80, 0xF0, // 2
+		0xF0, 0x10, 0xF0, 0x10, 0xF0, // 3
+		0x90, 0x90, 0xF0, 0x10, 0x10, // 4
+		0xF0, 0x80, 0xF0, 0x10, 0xF0, // 5
+		0xF0, 0x80, 0xF0, 0x90, 0xF0, // 6
+		0xF0, 0x10, 0x20, 0x40, 0x40, // 7
+		0xF0, 0x90, 0xF0, 0x90, 0xF0, // 8
+		0xF0, 0x90, 0xF0, 0x10, 0xF0, // 9
+		0xF0, 0x90, 0xF0, 0x90, 0x90, // A
+		0xE0, 0x90, 0xE0, 0x90, 0xE0, // B
+		0xF0, 0x80, 0x80, 0x80, 0xF0, // C
+		0xE0, 0x90, 0x90, 0x90, 0xE0, // D
+		0xF0, 0x80, 0xF0, 0x80, 0xF0, // E
+		0xF0, 0x80, 0xF0, 0x80, 0x80, // F
+	}
+
+	bigFont := [...]uint8{
+		0xFF, 0xFF, 0xC3, 0xC3, 0xC3, 0xC3, 0xC3, 0xC3, 0xFF, 0xFF, // 0
+		0x18, 0x78, 0x78, 0x18, 0x18, 0x18, 0x18, 0x18, 0xFF, 0xFF, // 1
+		0xFF, 0xFF, 0x03, 0x03, 0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, // 2
+		0xFF, 0xFF, 0x03, 0x03, 0xFF, 0xFF, 0x03, 0x03, 0xFF, 0xFF, // 3
+		0xC3, 0xC3, 0xC3, 0xC3, 0xFF, 0xFF, 0x03, 0x03, 0x03, 0x03, // 4
+		0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, 0x03, 0x03, 0xFF, 0xFF, // 5
+		0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, 0xC3, 0xC3, 0xFF, 0xFF, // 6
+		0xFF, 0xFF, 0x03, 0x03, 0x06, 0x0C, 0x18, 0x18, 0x18, 0x18, // 7
+		0xFF, 0xFF, 0xC3, 0xC3, 0xFF, 0xFF, 0xC3, 0xC3, 0xFF, 0xFF, // 8
+		0xFF, 0xFF, 0xC3, 0xC3, 0xFF, 0xFF, 0x03, 0x03, 0xFF, 0xFF, // 9
+		0x7E, 0xFF, 0xC3, 0xC3, 0xC3, 0xFF, 0xFF, 0xC3, 0xC3, 0xC3, // A
+		0xFC, 0xFC, 0xC3, 0xC3, 0xFC, 0xFC, 0xC3, 0xC3, 0xFC, 0xFC, // B
+		0x3C, 0xFF, 0xC3, 0xC0, 0xC0, 0xC0, 0xC0, 0xC3, 0xFF, 0x3C, // C
+		0xFC, 0xFE, 0xC3, 0xC3, 0xC3, 0xC3, 0xC3, 0xC3, 0xFE, 0xFC, // D
+		0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, // E
+		0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, 0xC0, 0xC0, 0xC0, 0xC0, // F
+	}
+
+	copy(chip8.ram[fontAddress:], font[:])
+	copy(chip8.ram[bigFontAddress:], bigFont[:])
+}
+
+// ReadRom reads a ROM image from disk. Octo sources ending in .8o are
+// compiled with CompileOcto.
+func ReadRom(romName string) ([]uint8, error) {
+	// Open ROM file
+	file, err := os.Open(romName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ROM: %w", err)
+	}
+	defer file.Close()
+
+	// Octo sources are compiled on the fly
+	if strings.EqualFold(filepath.Ext(romName), ".8o") {
+		romData, err := CompileOcto(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile %s:%w", romName, err)
+		}
+		return romData, nil
+	}
+
+	romData, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ROM: %w", err)
+	}
+
+	return romData, nil
+}
+
+// LoadRom copies romData into memory starting at entryPoint.
+func (chip8 *CHIP8) LoadRom(romData []uint8, entryPoint uint32) {
+	copy(chip8.ram[entryPoint:], romData)
+}
+
+func (chip8 *CHIP8) State() EmulatorState {
+	return chip8.state
+}
+
+func (chip8 *CHIP8) SetState(state EmulatorState) {
+	chip8.state = state
+}
+
+func (chip8 *CHIP8) RomName() string {
+	return chip8.romName
+}
+
+// Seed returns the seed of the CXNN random source.
+func (chip8 *CHIP8) Seed() uint64 {
+	return chip8.seed
+}
+
+// SetSeed reseeds the CXNN random source. The seed is kept across Reset so
+// a run can be reproduced from power on. It defaults to 0.
+func (chip8 *CHIP8) SetSeed(seed uint64) {
+	chip8.seed = seed
+	if chip8.random != nil {
+		chip8.random.Seed(seed)
+	}
+}
+
+// Random returns the CXNN random source.
+func (chip8 *CHIP8) Random() Random {
+	return chip8.random
+}
+
+// SetRandom replaces the CXNN random source and seeds it with the current
+// seed. The default is a PCGRandom.
+func (chip8 *CHIP8) SetRandom(random Random) {
+	chip8.random = random
+	chip8.random.Seed(chip8.seed)
+}
+
+// RomHash returns the SHA-1 of the loaded ROM image.
+func (chip8 *CHIP8) RomHash() [20]uint8 {
+	return chip8.romHash
+}
+
+func (chip8 *CHIP8) Extension() Extension {
+	return chip8.extension
+}
+
+func (chip8 *CHIP8) Quirks() Quirks {
+	return chip8.quirks
+}
+
+func (chip8 *CHIP8) UpdateTimers() {
+	if chip8.delayTimer > 0 {
+		chip8.delayTimer--
+	}
+
+	if chip8.soundTimer > 0 {
+		chip8.soundTimer--
+		chip8.beeping = true
+	} else {
+		chip8.beeping = false
+	}
+}
+
+// RunFrame executes up to instructions opcodes for one 60hz frame. With the
+// display wait quirk a lores DXYN ends the frame early, like the COSMAC VIP
+// waiting for its display interrupt before drawing.
+func (chip8 *CHIP8) RunFrame(instructions uint32) error {
+	chip8.vblankWait = false
+
+	for i := uint32(0); i < instructions && chip8.state == RUNNING; i++ {
+		if chip8.shouldBreak() {
+			return ErrBreak
+		}
+
+		if err := chip8.ExecuteInstruction(); err != nil {
+			return err
+		}
+
+		if chip8.vblankWait {
+			break
+		}
+	}
+
+	return nil
+}
+
+// ExecuteInstruction runs the opcode at PC. A *Fault is returned, and the
+// machine is left FAULTED, when the program misbehaves. A *WatchHit is
+// returned after an instruction that triggered a watchpoint.
+func (chip8 *CHIP8) ExecuteInstruction() error {
+	if chip8.trace != nil {
+		chip8.trace.record(chip8)
+	}
+	if chip8.profiler != nil {
+		chip8.profiler.record(chip8)
+	}
+
+	if len(chip8.watchpoints) == 0 {
+		return chip8.execute()
+	}
+
+	chip8.watchHit = nil
+	v, i := chip8.V, chip8.I
+
+	if err := chip8.execute(); err != nil {
+		return err
+	}
+
+	chip8.watchRegisters(v, i)
+	if chip8.watchHit != nil {
+		return chip8.watchHit
+	}
+
+	return nil
+}
+
+func (chip8 *CHIP8) execute() error {
+	var carry bool
+
+	// Get the next opcode from the ram
+	chip8.instPC = chip8.PC
+	chip8.inst.opcode = 0
+	hi, err := chip8.fetch(int(chip8.PC))
+	if err != nil {
+		return err
+	}
+	lo, err := chip8.fetch(int(chip8.PC) + 1)
+	if err != nil {
+		return err
+	}
+	chip8.inst = decode(uint16(hi)<<8 | uint16(lo))
+	chip8.PC += 2 // Pre-increment program counter for next opcode
+
+	switch (chip8.inst.opcode >> 12) & 0x0F {
+	case 0x00:
+		switch {
+		case chip8.inst.NNN == 0x0E0:
+			// 0x00E0: Clear the screen (XO-CHIP: selected planes only)
+			chip8.clearDisplay()
+		case chip8.inst.NNN == 0x0EE:
+			// 0x00EE: Return from subroutine
+			if chip8.stackPointer == 0 {
+				return chip8.raise(ErrStackUnderflow, 0)
+			}
+			chip8.stackPointer--
+			chip8.PC = chip8.stack[chip8.stackPointer]
+		case chip8.extension != CHIP_8 && chip8.inst.NNN&0xFF0 == 0x0C0:
+			// 0x00CN: SCHIP scroll display down N pixels
+			chip8.scrollDown(int(chip8.inst.N))
+		case chip8.extension == XOCHIP && chip8.inst.NNN&0xFF0 == 0x0D0:
+			// 0x00DN: XO-CHIP scroll display up N pixels
+			chip8.scrollUp(int(chip8.inst.N))
+		case chip8.extension != CHIP_8 && chip8.inst.NNN == 0x0FB:
+			// 0x00FB: SCHIP scroll display right 4 pixels
+			chip8.scrollRight(4)
+		case chip8.extension != CHIP_8 && chip8.inst.NNN == 0x0FC:
+			// 0x00FC: SCHIP scroll display left 4 pixels
+			chip8.scrollLeft(4)
+		case chip8.extension != CHIP_8 && chip8.inst.NNN == 0x0FD:
+			// 0x00FD: SCHIP exit interpreter
+			chip8.state = QUIT
+		case chip8.extension != CHIP_8 && chip8.inst.NNN == 0x0FE:
+			// 0x00FE: SCHIP disable high resolution mode
+			chip8.setHires(false)
+		case chip8.extension != CHIP_8 && chip8.inst.NNN == 0x0FF:
+			// 0x00FF: SCHIP enable 128x64 high resolution mode
+			chip8.setHires(true)
+		default:
+			// Unimplemented/invalid opcode, may be 0xNNN for calling machine code routine for RCA1802
+			return chip8.raise(ErrIllegalOpcode, 0)
+		}
+	case 0x01:
+		// 0x1NNN: Jump to address NNN
+		chip8.PC = chip8.inst.NNN
+	case 0x02:
+		// 0x2NNN: Call subroutine at NNN
+		if int(chip8.stackPointer) >= chip8.stackDepth() {
+			return chip8.raise(ErrStackOverflow, 0)
+		}
+		chip8.stack[chip8.stackPointer] = chip8.PC
+		chip8.stackPointer++
+		chip8.PC = chip8.inst.NNN
+	case 0x03:
+		// 0x3XNN: Check if VX == NN, if so, skip the next instruction
+		if chip8.V[chip8.inst.X] == chip8.inst.NN {
+			chip8.skip()
+		}
+	case 0x04:
+		// 0x4XNN: Check if VX != NN, if so, skip the next instruction
+		if chip8.V[chip8.inst.X] != chip8.inst.NN {
+			chip8.skip()
+		}
+	case 0x05:
+		switch chip8.inst.N {
+		case 0:
+			// 0x5XY0: Check if VX == VY, if so, skip the next instruction
+			if chip8.V[chip8.inst.X] == chip8.V[chip8.inst.Y] {
+				chip8.skip()
+			}
+		case 2:
+			// 0x5XY2: XO-CHIP save VX-VY inclusive to memory at I, I is not incremented
+			if chip8.extension != XOCHIP {
+				return chip8.raise(ErrIllegalOpcode, 0)
+			}
+			for i, reg := range chip8.registerRange() {
+				if err := chip8.write(int(chip8.I)+i, chip8.V[reg]); err != nil {
+					return err
+				}
+			}
+		case 3:
+			// 0x5XY3: XO-CHIP load VX-VY inclusive from memory at I, I is not incremented
+			if chip8.extension != XOCHIP {
+				return chip8.raise(ErrIllegalOpcode, 0)
+			}
+			for i, reg := range chip8.registerRange() {
+				if chip8.V[reg], err = chip8.read(int(chip8.I) + i); err != nil {
+					return err
+				}
+			}
+		default:
+			return chip8.raise(ErrIllegalOpcode, 0)
+		}
+	case 0x06:
+		// 0x6XNN: Set register VX to NN
+		chip8.V[chip8.inst.X] = chip8.inst.NN
+	case 0x07:
+		// 0x7XNN: Set register VX += NN
+		chip8.V[chip8.inst.X] += chip8.inst.NN
+	case 0x08:
+		switch chip8.inst.N {
+		case 0:
+			// 0x8XY0: Set register VX = VY
+			chip8.V[chip8.inst.X] = chip8.V[chip8.inst.Y]
+		case 1:
+			// 0x8XY1: Set register VX |= VY
+			chip8.V[chip8.inst.X] |= chip8.V[chip8.inst.Y]
+			if chip8.quirks.VFReset {
+				chip8.V[0xF] = 0
+			}
+		case 2:
+			// 0x8XY2: Set register VX &= VY
+			chip8.V[chip8.inst.X] &= chip8.V[chip8.inst.Y]
+			if chip8.quirks.VFReset {
+				chip8.V[0xF] = 0
+			}
+		case 3:
+			// 0x8XY3: Set register VX ^= VY
+			chip8.V[chip8.inst.X] ^= chip8.V[chip8.inst.Y]
+			if chip8.quirks.VFReset {
+				chip8.V[0xF] = 0
+			}
+		case 4:
+			// 0x8XY4: Set register VX += VY, set VF to 1 if carry, 0 if not
+			carry = (uint16(chip8.V[chip8.inst.X]) + uint16(chip8.V[chip8.inst.Y])) > 255
+
+			chip8.V[chip8.inst.X] += chip8.V[chip8.inst.Y]
+
+			if carry {
+				chip8.V[0xF] = 1
+			} else {
+				chip8.V[0xF] = 0
+			}
+		case 5:
+			// 0x8XY5: Set register VX -= VY, set VF to 1 if there is not a borrow (result is positive/0)
+			carry = chip8.V[chip8.inst.Y] <= chip8.V[chip8.inst.X]
+
+			chip8.V[chip8.inst.X] -= chip8.V[chip8.inst.Y]
+
+			if carry {
+				chip8.V[0xF] = 1
+			} else {
+				chip8.V[0xF] = 0
+			}
+		case 6:
+			// 0x8XY6: Set register VX >>= 1, store shifted off bit in VF
+			var carry uint8
+
+			if chip8.quirks.Shifting {
+				carry = chip8.V[chip8.inst.X] & 1
+				chip8.V[chip8.inst.X] >>= 1
+			} else {
+				carry = chip8.V[chip8.inst.Y] & 1
+				chip8.V[chip8.inst.X] = chip8.V[chip8.inst.Y] >> 1
+			}
+
+			chip8.V[0xF] = carry
+		case 7:
+			// 0x8XY7: Set register VX = VY - VX, set VF to 1 if there is not a borrow (result is positive/0)
+			carry = chip8.V[chip8.inst.X] <= chip8.V[chip8.inst.Y]
+
+			chip8.V[chip8.inst.X] = chip8.V[chip8.inst.Y] - chip8.V[chip8.inst.X]
+
+			if carry {
+				chip8.V[0xF] = 1
+			} else {
+				chip8.V[0xF] = 0
+			}
+		case 0xE:
+			// 0x8XYE: Set register VX <<= 1, store shifted off bit in VF
+			var carry uint8
+
+			if chip8.quirks.Shifting {
+				carry = (chip8.V[chip8.inst.X] & 0x80) >> 7
+				chip8.V[chip8.inst.X] <<= 1
+			} else {
+				carry = (chip8.V[chip8.inst.Y] & 0x80) >> 7
+				chip8.V[chip8.inst.X] = chip8.V[chip8.inst.Y] << 1
+			}
+
+			chip8.V[0xF] = carry
+		default:
+			// Wrong/unimplemented opcode
+			return chip8.raise(ErrIllegalOpcode, 0)
+		}
+	case 0x09:
+		// 0x9XY0: Check if VX != VY; Skip next instruction if so
+		if chip8.inst.N != 0 {
+			return chip8.raise(ErrIllegalOpcode, 0)
+		}
+
+		if chip8.V[chip8.inst.X] != chip8.V[chip8.inst.Y] {
+			chip8.skip()
+		}
+	case 0x0A:
+		// 0xANNN: Set index register I to NNN
+		chip8.I = chip8.inst.NNN
+	case 0x0B:
+		if chip8.quirks.Jumping {
+			// 0xBXNN: CHIP-48/SCHIP jump to VX + XNN
+			chip8.PC = uint16(chip8.V[chip8.inst.X]) + chip8.inst.NNN
+		} else {
+			// 0xBNNN: Jump to V0 + NNN
+			chip8.PC = uint16(chip8.V[0]) + chip8.inst.NNN
+		}
+	case 0x0C:
+		// 0xCXNN: Sets register VX = rand() % 256 & NN (bitwise AND)
+		chip8.V[chip8.inst.X] = chip8.random.Byte() & chip8.inst.NN
+	case 0x0D:
+		// 0xDXYN: Draw N-height sprite at coords X, Y: Read from memory location I
+		//   Screen pixels are XOR'd with sprite bits,
+		//   VF (Carry flag) is set if any screen pixels are set off; This is useful
+		//   for collision detection or other reasons.
+		//   SCHIP: N == 0 draws a 16x16 sprite, and with the row collisions quirk
+		//   hires mode VF counts the rows that collided or were clipped off the bottom edge.
+		//   Without the clipping quirk, sprites wrap around the edges.
+		//   XO-CHIP: sprites are drawn once per selected plane, with the data for
+		//   each plane stored one after another.
+		width, height := chip8.Width(), chip8.Height()
+		xCoord := int(chip8.V[chip8.inst.X]) % width
+		yCoord := int(chip8.V[chip8.inst.Y]) % height
+		wrap := !chip8.quirks.Clipping
+
+		spriteWidth, spriteHeight := 8, int(chip8.inst.N)
+		if chip8.inst.N == 0 && chip8.extension != CHIP_8 {
+			spriteWidth, spriteHeight = 16, 16
+		}
+		bytesPerRow := spriteWidth / 8
+
+		chip8.V[0xF] = 0 // reset VF (collision flag)
+		collisions := 0
+		addr := int(chip8.I)
+
+		for plane := uint8(0x1); plane <= 0x2; plane <<= 1 {
+			if chip8.planes&plane == 0 {
+				continue
+			}
+
+			for row := 0; row < spriteHeight; row++ {
+				// Stop drawing sprite if we hit bottom edge
+				y := yCoord + row
+				if y >= height && !wrap {
+					collisions += spriteHeight - row
+					break
+				}
+
+				// Get sprite row from memory, left aligned in 16 bits
+				rowAddr := addr + row*bytesPerRow
+				spriteByte, err := chip8.read(rowAddr)
+				if err != nil {
+					return err
+				}
+				spriteData := uint16(spriteByte) << 8
+				if spriteWidth == 16 {
+					if spriteByte, err = chip8.read(rowAddr + 1); err != nil {
+						return err
+					}
+					spriteData |= uint16(spriteByte)
+				}
+
+				rowCollision := false
+				for col := 0; col < spriteWidth; col++ {
+					// Stop drawing row if we hit right edge
+					x := xCoord + col
+					if x >= width && !wrap {
+						break
+					}
+
+					spriteBit := (spriteData & (0x8000 >> col)) != 0
+
+					if chip8.setPixel(x, y, plane, spriteBit) {
+						rowCollision = true
+					}
+				}
+
+				if rowCollision {
+					collisions++
+					chip8.V[0xF] = 1
+				}
+			}
+
+			addr += spriteHeight * bytesPerRow
+		}
+
+		if chip8.hires && chip8.quirks.RowCollisions {
+			chip8.V[0xF] = uint8(collisions)
+		}
+
+		if chip8.quirks.DisplayWait && !chip8.hires {
+			chip8.vblankWait = true
+		}
+	case 0x0E:
+		switch chip8.inst.NN {
+		case 0x9E:
+			// 0xEX9E: Skip next instruction if key in VX is pressed
+			if chip8.keypad[chip8.V[chip8.inst.X]&0xF] {
+				chip8.skip()
+			}
+		case 0xA1:
+			// 0xEXA1: Skip next instruction if key in VX is not pressed
+			if !chip8.keypad[chip8.V[chip8.inst.X]&0xF] {
+				chip8.skip()
+			}
+		default:
+			return chip8.raise(ErrIllegalOpcode, 0)
+		}
+	case 0x0F:
+		switch chip8.inst.NN {
+		case 0x00:
+			// 0xF000 NNNN: XO-CHIP set I to the 16 bit address in the next word
+			if chip8.extension != XOCHIP || chip8.inst.X != 0 {
+				return chip8.raise(ErrIllegalOpcode, 0)
+			}
+			hi, err := chip8.fetch(int(chip8.PC))
+			if err != nil {
+				return err
+			}
+			lo, err := chip8.fetch(int(chip8.PC) + 1)
+			if err != nil {
+				return err
+			}
+			chip8.I = uint16(hi)<<8 | uint16(lo)
+			chip8.PC += 2
+		case 0x01:
+			// 0xFN01: XO-CHIP select drawing bitplanes N (0-3)
+			if chip8.extension != XOCHIP || chip8.inst.X > 3 {
+				return chip8.raise(ErrIllegalOpcode, 0)
+			}
+			chip8.planes = chip8.inst.X
+		case 0x02:
+			// 0xF002: XO-CHIP load 16 byte audio pattern from memory at I
+			if chip8.extension != XOCHIP || chip8.inst.X != 0 {
+				return chip8.raise(ErrIllegalOpcode, 0)
+			}
+			for i := range chip8.audioPattern {
+				if chip8.audioPattern[i], err = chip8.read(int(chip8.I) + i); err != nil {
+					return err
+				}
+			}
+			chip8.hasPattern = true
+		case 0x3A:
+			// 0xFX3A: XO-CHIP set audio pitch register to VX
+			if chip8.extension != XOCHIP {
+				return chip8.raise(ErrIllegalOpcode, 0)
+			}
+			chip8.pitch = chip8.V[chip8.inst.X]
+		case 0x0A:
+			// 0xFX0A: VX = get_key(); Await a keypress and its release, then store the key in VX.
+			//   The instruction repeats until then, remembering the pressed key between tries.
+			if !chip8.keyHeld {
+				for i, pressed := range chip8.keypad {
+					if pressed {
+						chip8.keyHeld, chip8.heldKey = true, uint8(i)
+						break
+					}
+				}
+				chip8.PC -= 2
+			} else if chip8.keypad[chip8.heldKey] {
+				chip8.PC -= 2
+			} else {
+				chip8.V[chip8.inst.X] = chip8.heldKey // VX = key
+				chip8.keyHeld = false
+			}
+		case 0x1E:
+			// 0xFX1E: I += VX; Add VX to register I. For non-Amiga CHIP8, does not affect VF
+			chip8.I += uint16(chip8.V[chip8.inst.X])
+		case 0x07:
+			// 0xFX07: VX = delay timer
+			chip8.V[chip8.inst.X] = chip8.delayTimer
+		case 0x15:
+			// 0xFX15: delay timer = VX
+			chip8.delayTimer = chip8.V[chip8.inst.X]
+		case 0x18:
+			// 0xFX18: sound timer = VX
+			chip8.soundTimer = chip8.V[chip8.inst.X]
+		case 0x29:
+			// 0xFX29: Set register I to sprite location in memory for character in VX (0x0-0xF)
+			chip8.I = fontAddress + uint16(chip8.V[chip8.inst.X]&0xF)*5
+		case 0x30:
+			// 0xFX30: SCHIP set register I to 8x10 sprite location for digit in VX
+			if chip8.extension == CHIP_8 {
+				return chip8.raise(ErrIllegalOpcode, 0)
+			}
+			chip8.I = bigFontAddress + uint16(chip8.V[chip8.inst.X]&0xF)*10
+		case 0x33:
+			// 0xFX33: Store BCD representation of VX at memory offset from I;
+			//   I = hundred's place, I+1 = ten's place, I+2 = one's place
+			var bcd uint8 = chip8.V[chip8.inst.X]
+			digits := [3]uint8{bcd / 100, bcd / 10 % 10, bcd % 10}
+			for i, digit := range digits {
+				if err := chip8.write(int(chip8.I)+i, digit); err != nil {
+					return err
+				}
+			}
+		case 0x55:
+			// 0xFX55: Register dump V0-VX inclusive to memory offset from I;
+			//   I is only advanced with the memory increment quirk
+			var i uint8
+			for i = 0; i <= chip8.inst.X; i++ {
+				if err := chip8.write(int(chip8.I)+int(i), chip8.V[i]); err != nil {
+					return err
+				}
+			}
+			chip8.incrementI()
+		case 0x65:
+			// 0xFX65: Register load V0-VX inclusive from memory offset from I;
+			//   I is only advanced with the memory increment quirk
+			var i uint8
+			for i = 0; i <= chip8.inst.X; i++ {
+				if chip8.V[i], err = chip8.read(int(chip8.I) + int(i)); err != nil {
+					return err
+				}
+			}
+			chip8.incrementI()
+		case 0x75:
+			// 0xFX75: SCHIP store V0-VX inclusive in RPL user flags
+			if chip8.extension == CHIP_8 {
+				return chip8.raise(ErrIllegalOpcode, 0)
+			}
+			copy(chip8.rpl[:chip8.inst.X+1], chip8.V[:chip8.inst.X+1])
+		case 0x85:
+			// 0xFX85: SCHIP load V0-VX inclusive from RPL user flags
+			if chip8.extension == CHIP_8 {
+				return chip8.raise(ErrIllegalOpcode, 0)
+			}
+			copy(chip8.V[:chip8.inst.X+1], chip8.rpl[:chip8.inst.X+1])
+		default:
+			return chip8.raise(ErrIllegalOpcode, 0)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,1178 @@
+package core
+
+import (
+	"errors"
+	"testing"
+)
+
+// fixedRandom makes CXNN deterministic.
+type fixedRandom uint8
+
+func (r fixedRandom) Seed(uint64)                    {}
+func (r fixedRandom) Byte() uint8                    { return uint8(r) }
+func (r fixedRandom) MarshalBinary() ([]byte, error) { return []byte{uint8(r)}, nil }
+func (r *fixedRandom) UnmarshalBinary(data []byte) error {
+	*r = fixedRandom(data[0])
+	return nil
+}
+
+// opcodeTest loads code at the entry point of a fresh machine, runs setup,
+// executes one instruction and hands the machine to check. err is the fault
+// the instruction must raise, if any.
+type opcodeTest struct {
+	name      string
+	extension Extension
+	quirks    Quirks
+	code      []uint8
+	setup     func(c *CHIP8)
+	check     func(t *testing.T, c *CHIP8)
+	err       error
+}
+
+func newTestMachine(extension Extension, quirks Quirks, code []uint8) *CHIP8 {
+	c := &CHIP8{}
+	c.InitData("test", code, extension, quirks)
+	r := fixedRandom(0xAB)
+	c.SetRandom(&r)
+	return c
+}
+
+func expect[T comparable](t *testing.T, what string, got, want T) {
+	t.Helper()
+	if got != want {
+		t.Errorf("%s = %#v, want %#v", what, got, want)
+	}
+}
+
+// lit sets pixel x, y on plane 1 for display setups.
+func lit(c *CHIP8, x, y int) {
+	c.display[y*c.Width()+x] |= 1
+}
+
+func expectPC(t *testing.T, c *CHIP8, pc uint16) {
+	t.Helper()
+	expect(t, "PC", c.PC, pc)
+}
+
+func expectV(t *testing.T, c *CHIP8, x int, v uint8) {
+	t.Helper()
+	expect(t, "V["+string("0123456789ABCDEF"[x])+"]", c.V[x], v)
+}
+
+func expectPixel(t *testing.T, c *CHIP8, x, y int, planes uint8) {
+	t.Helper()
+	expect(t, "pixel", [3]int{x, y, int(c.Pixel(x, y))}, [3]int{x, y, int(planes)})
+}
+
+var vip = profiles["vip"].Quirks
+
+var opcodeTests = []opcodeTest{
+	// 0NNN
+	{
+		name: "00E0 clears the display",
+		code: []uint8{0x00, 0xE0},
+		setup: func(c *CHIP8) {
+			lit(c, 0, 0)
+			lit(c, 63, 31)
+		},
+		check: func(t *testing.T, c *CHIP8) {
+			expectPixel(t, c, 0, 0, 0)
+			expectPixel(t, c, 63, 31, 0)
+			expectPC(t, c, 0x202)
+		},
+	},
+	{
+		name:      "00E0 XO-CHIP clears only the selected planes",
+		extension: XOCHIP,
+		code:      []uint8{0x00, 0xE0},
+		setup: func(c *CHIP8) {
+			c.display[0] = 0x3
+			c.planes = 0x1
+		},
+		check: func(t *testing.T, c *CHIP8) {
+			expectPixel(t, c, 0, 0, 0x2)
+		},
+	},
+	{
+		name: "00EE returns from a subroutine",
+		code: []uint8{0x00, 0xEE},
+		setup: func(c *CHIP8) {
+			c.stack[0] = 0x346
+			c.stackPointer = 1
+		},
+		check: func(t *testing.T, c *CHIP8) {
+			expectPC(t, c, 0x346)
+			expect(t, "stack pointer", c.stackPointer, 0)
+		},
+	},
+	{
+		name: "00EE with an empty stack underflows",
+		code: []uint8{0x00, 0xEE},
+		err:  ErrStackUnderflow,
+	},
+	{
+		name:      "00CN scrolls down N rows",
+		extension: SUPERCHIP,
+		code:      []uint8{0x00, 0xC2},
+		setup:     func(c *CHIP8) { lit(c, 5, 0) },
+		check: func(t *testing.T, c *CHIP8) {
+			expectPixel(t, c, 5, 0, 0)
+			expectPixel(t, c, 5, 2, 1)
+		},
+	},
+	{
+		name: "00CN is illegal on CHIP-8",
+		code: []uint8{0x00, 0xC2},
+		err:  ErrIllegalOpcode,
+	},
+	{
+		name:      "00DN scrolls up N rows",
+		extension: XOCHIP,
+		code:      []uint8{0x00, 0xD2},
+		setup:     func(c *CHIP8) { lit(c, 5, 3) },
+		check: func(t *testing.T, c *CHIP8) {
+			expectPixel(t, c, 5, 3, 0)
+			expectPixel(t, c, 5, 1, 1)
+		},
+	},
+	{
+		name:      "00DN is illegal on SUPER-CHIP",
+		extension: SUPERCHIP,
+		code:      []uint8{0x00, 0xD2},
+		err:       ErrIllegalOpcode,
+	},
+	{
+		name:      "00FB scrolls right 4 pixels",
+		extension: SUPERCHIP,
+		code:      []uint8{0x00, 0xFB},
+		setup: func(c *CHIP8) {
+			lit(c, 0, 0)
+			lit(c, 63, 1)
+		},
+		check: func(t *testing.T, c *CHIP8) {
+			expectPixel(t, c, 0, 0, 0)
+			expectPixel(t, c, 4, 0, 1)
+			expectPixel(t, c, 63, 1, 0)
+			expectPixel(t, c, 3, 1, 0)
+		},
+	},
+	{
+		name:      "00FC scrolls left 4 pixels",
+		extension: SUPERCHIP,
+		code:      []uint8{0x00, 0xFC},
+		setup: func(c *CHIP8) {
+			lit(c, 4, 0)
+			lit(c, 0, 1)
+		},
+		check: func(t *testing.T, c *CHIP8) {
+			expectPixel(t, c, 0, 0, 1)
+			expectPixel(t, c, 4, 0, 0)
+			expectPixel(t, c, 60, 1, 0)
+		},
+	},
+	{
+		name:      "00FD exits",
+		extension: SUPERCHIP,
+		code:      []uint8{0x00, 0xFD},
+		check: func(t *testing.T, c *CHIP8) {
+			expect(t, "state", c.State(), QUIT)
+		},
+	},
+	{
+		name:      "00FF enables hires and clears the display",
+		extension: SUPERCHIP,
+		code:      []uint8{0x00, 0xFF},
+		setup:     func(c *CHIP8) { lit(c, 1, 1) },
+		check: func(t *testing.T, c *CHIP8) {
+			expect(t, "width", c.Width(), HiresWidth)
+			expect(t, "height", c.Height(), HiresHeight)
+			expectPixel(t, c, 1, 1, 0)
+		},
+	},
+	{
+		name:      "00FE disables hires",
+		extension: SUPERCHIP,
+		code:      []uint8{0x00, 0xFE},
+		setup:     func(c *CHIP8) { c.setHires(true) },
+		check: func(t *testing.T, c *CHIP8) {
+			expect(t, "width", c.Width(), DisplayWidth)
+		},
+	},
+	{
+		name: "00FF is illegal on CHIP-8",
+		code: []uint8{0x00, 0xFF},
+		err:  ErrIllegalOpcode,
+	},
+	{
+		name: "0NNN machine code calls are illegal",
+		code: []uint8{0x01, 0x23},
+		err:  ErrIllegalOpcode,
+	},
+
+	// 1NNN, 2NNN, BNNN
+	{
+		name:  "1NNN jumps",
+		code:  []uint8{0x13, 0x45},
+		check: func(t *testing.T, c *CHIP8) { expectPC(t, c, 0x345) },
+	},
+	{
+		name: "2NNN pushes the return address",
+		code: []uint8{0x23, 0x00},
+		check: func(t *testing.T, c *CHIP8) {
+			expectPC(t, c, 0x300)
+			expect(t, "stack pointer", c.stackPointer, 1)
+			expect(t, "stack[0]", c.stack[0], 0x202)
+		},
+	},
+	{
+		name:  "2NNN overflows after 12 calls on CHIP-8",
+		code:  []uint8{0x23, 0x00},
+		setup: func(c *CHIP8) { c.stackPointer = 12 },
+		err:   ErrStackOverflow,
+	},
+	{
+		name:      "2NNN allows 16 calls on SUPER-CHIP",
+		extension: SUPERCHIP,
+		code:      []uint8{0x23, 0x00},
+		setup:     func(c *CHIP8) { c.stackPointer = 15 },
+		check:     func(t *testing.T, c *CHIP8) { expect(t, "stack pointer", c.stackPointer, 16) },
+	},
+	{
+		name:      "2NNN overflows after 16 calls on SUPER-CHIP",
+		extension: SUPERCHIP,
+		code:      []uint8{0x23, 0x00},
+		setup:     func(c *CHIP8) { c.stackPointer = 16 },
+		err:       ErrStackOverflow,
+	},
+	{
+		name: "BNNN jumps to NNN + V0",
+		code: []uint8{0xB2, 0x10},
+		setup: func(c *CHIP8) {
+			c.V[0] = 0x04
+			c.V[2] = 0x08
+		},
+		check: func(t *testing.T, c *CHIP8) { expectPC(t, c, 0x214) },
+	},
+	{
+		name:   "BXNN with the jumping quirk jumps to XNN + VX",
+		quirks: Quirks{Jumping: true},
+		code:   []uint8{0xB2, 0x10},
+		setup: func(c *CHIP8) {
+			c.V[0] = 0x04
+			c.V[2] = 0x08
+		},
+		check: func(t *testing.T, c *CHIP8) { expectPC(t, c, 0x218) },
+	},
+
+	// Skips
+	{
+		name:  "3XNN skips when VX == NN",
+		code:  []uint8{0x31, 0x42},
+		setup: func(c *CHIP8) { c.V[1] = 0x42 },
+		check: func(t *testing.T, c *CHIP8) { expectPC(t, c, 0x204) },
+	},
+	{
+		name:  "3XNN doesn't skip when VX != NN",
+		code:  []uint8{0x31, 0x42},
+		check: func(t *testing.T, c *CHIP8) { expectPC(t, c, 0x202) },
+	},
+	{
+		name:      "3XNN skips the whole F000 NNNN on XO-CHIP",
+		extension: XOCHIP,
+		code:      []uint8{0x31, 0x00, 0xF0, 0x00, 0x12, 0x34},
+		check:     func(t *testing.T, c *CHIP8) { expectPC(t, c, 0x206) },
+	},
+	{
+		name:  "3XNN skips F000 as two bytes on CHIP-8",
+		code:  []uint8{0x31, 0x00, 0xF0, 0x00, 0x12, 0x34},
+		check: func(t *testing.T, c *CHIP8) { expectPC(t, c, 0x204) },
+	},
+	{
+		name:  "4XNN skips when VX != NN",
+		code:  []uint8{0x41, 0x42},
+		check: func(t *testing.T, c *CHIP8) { expectPC(t, c, 0x204) },
+	},
+	{
+		name:  "4XNN doesn't skip when VX == NN",
+		code:  []uint8{0x41, 0x42},
+		setup: func(c *CHIP8) { c.V[1] = 0x42 },
+		check: func(t *testing.T, c *CHIP8) { expectPC(t, c, 0x202) },
+	},
+	{
+		name: "5XY0 skips when VX == VY",
+		code: []uint8{0x51, 0x20},
+		setup: func(c *CHIP8) {
+			c.V[1] = 7
+			c.V[2] = 7
+		},
+		check: func(t *testing.T, c *CHIP8) { expectPC(t, c, 0x204) },
+	},
+	{
+		name:  "5XY0 doesn't skip when VX != VY",
+		code:  []uint8{0x51, 0x20},
+		setup: func(c *CHIP8) { c.V[1] = 7 },
+		check: func(t *testing.T, c *CHIP8) { expectPC(t, c, 0x202) },
+	},
+	{
+		name: "5XY1 is illegal",
+		code: []uint8{0x51, 0x21},
+		err:  ErrIllegalOpcode,
+	},
+	{
+		name:  "9XY0 skips when VX != VY",
+		code:  []uint8{0x91, 0x20},
+		setup: func(c *CHIP8) { c.V[1] = 7 },
+		check: func(t *testing.T, c *CHIP8) { expectPC(t, c, 0x204) },
+	},
+	{
+		name:  "9XY0 doesn't skip when VX == VY",
+		code:  []uint8{0x91, 0x20},
+		check: func(t *testing.T, c *CHIP8) { expectPC(t, c, 0x202) },
+	},
+	{
+		name: "9XY1 is illegal",
+		code: []uint8{0x91, 0x21},
+		err:  ErrIllegalOpcode,
+	},
+	{
+		name:  "EX9E skips when the key in VX is held",
+		code:  []uint8{0xE1, 0x9E},
+		setup: func(c *CHIP8) { c.V[1] = 0x5; c.SetKey(0x5, true) },
+		check: func(t *testing.T, c *CHIP8) { expectPC(t, c, 0x204) },
+	},
+	{
+		name:  "EX9E doesn't skip when the key in VX is up",
+		code:  []uint8{0xE1, 0x9E},
+		setup: func(c *CHIP8) { c.V[1] = 0x5; c.SetKey(0x6, true) },
+		check: func(t *testing.T, c *CHIP8) { expectPC(t, c, 0x202) },
+	},
+	{
+		name:  "EX9E only uses the low nibble of VX",
+		code:  []uint8{0xE1, 0x9E},
+		setup: func(c *CHIP8) { c.V[1] = 0x15; c.SetKey(0x5, true) },
+		check: func(t *testing.T, c *CHIP8) { expectPC(t, c, 0x204) },
+	},
+	{
+		name:  "EXA1 skips when the key in VX is up",
+		code:  []uint8{0xE1, 0xA1},
+		setup: func(c *CHIP8) { c.V[1] = 0x5 },
+		check: func(t *testing.T, c *CHIP8) { expectPC(t, c, 0x204) },
+	},
+	{
+		name:  "EXA1 doesn't skip when the key in VX is held",
+		code:  []uint8{0xE1, 0xA1},
+		setup: func(c *CHIP8) { c.V[1] = 0x5; c.SetKey(0x5, true) },
+		check: func(t *testing.T, c *CHIP8) { expectPC(t, c, 0x202) },
+	},
+	{
+		name: "EX00 is illegal",
+		code: []uint8{0xE1, 0x00},
+		err:  ErrIllegalOpcode,
+	},
+
+	// Register loads and arithmetic
+	{
+		name:  "6XNN loads NN",
+		code:  []uint8{0x6A, 0x42},
+		check: func(t *testing.T, c *CHIP8) { expectV(t, c, 0xA, 0x42) },
+	},
+	{
+		name:  "7XNN adds NN without touching VF",
+		code:  []uint8{0x71, 0x02},
+		setup: func(c *CHIP8) { c.V[1] = 0xFF },
+		check: func(t *testing.T, c *CHIP8) {
+			expectV(t, c, 1, 0x01)
+			expectV(t, c, 0xF, 0)
+		},
+	},
+	{
+		name:  "8XY0 copies VY",
+		code:  []uint8{0x81, 0x20},
+		setup: func(c *CHIP8) { c.V[2] = 0x42 },
+		check: func(t *testing.T, c *CHIP8) { expectV(t, c, 1, 0x42) },
+	},
+	{
+		name:  "8XY1 ORs and keeps VF",
+		code:  []uint8{0x81, 0x21},
+		setup: func(c *CHIP8) { c.V[1], c.V[2], c.V[0xF] = 0x0C, 0x03, 0x55 },
+		check: func(t *testing.T, c *CHIP8) {
+			expectV(t, c, 1, 0x0F)
+			expectV(t, c, 0xF, 0x55)
+		},
+	},
+	{
+		name:   "8XY1 with the VF reset quirk clears VF",
+		quirks: Quirks{VFReset: true},
+		code:   []uint8{0x81, 0x21},
+		setup:  func(c *CHIP8) { c.V[1], c.V[2], c.V[0xF] = 0x0C, 0x03, 0x55 },
+		check: func(t *testing.T, c *CHIP8) {
+			expectV(t, c, 1, 0x0F)
+			expectV(t, c, 0xF, 0)
+		},
+	},
+	{
+		name:  "8XY2 ANDs and keeps VF",
+		code:  []uint8{0x81, 0x22},
+		setup: func(c *CHIP8) { c.V[1], c.V[2], c.V[0xF] = 0x0C, 0x06, 0x55 },
+		check: func(t *testing.T, c *CHIP8) {
+			expectV(t, c, 1, 0x04)
+			expectV(t, c, 0xF, 0x55)
+		},
+	},
+	{
+		name:   "8XY2 with the VF reset quirk clears VF",
+		quirks: Quirks{VFReset: true},
+		code:   []uint8{0x81, 0x22},
+		setup:  func(c *CHIP8) { c.V[1], c.V[2], c.V[0xF] = 0x0C, 0x06, 0x55 },
+		check: func(t *testing.T, c *CHIP8) {
+			expectV(t, c, 1, 0x04)
+			expectV(t, c, 0xF, 0)
+		},
+	},
+	{
+		name:  "8XY3 XORs and keeps VF",
+		code:  []uint8{0x81, 0x23},
+		setup: func(c *CHIP8) { c.V[1], c.V[2], c.V[0xF] = 0x0C, 0x06, 0x55 },
+		check: func(t *testing.T, c *CHIP8) {
+			expectV(t, c, 1, 0x0A)
+			expectV(t, c, 0xF, 0x55)
+		},
+	},
+	{
+		name:   "8XY3 with the VF reset quirk clears VF",
+		quirks: Quirks{VFReset: true},
+		code:   []uint8{0x81, 0x23},
+		setup:  func(c *CHIP8) { c.V[1], c.V[2], c.V[0xF] = 0x0C, 0x06, 0x55 },
+		check: func(t *testing.T, c *CHIP8) {
+			expectV(t, c, 1, 0x0A)
+			expectV(t, c, 0xF, 0)
+		},
+	},
+	{
+		name:  "8XY4 adds without carry",
+		code:  []uint8{0x81, 0x24},
+		setup: func(c *CHIP8) { c.V[1], c.V[2], c.V[0xF] = 0x10, 0x20, 0x55 },
+		check: func(t *testing.T, c *CHIP8) {
+			expectV(t, c, 1, 0x30)
+			expectV(t, c, 0xF, 0)
+		},
+	},
+	{
+		name:  "8XY4 sets VF on carry",
+		code:  []uint8{0x81, 0x24},
+		setup: func(c *CHIP8) { c.V[1], c.V[2] = 0xFF, 0x02 },
+		check: func(t *testing.T, c *CHIP8) {
+			expectV(t, c, 1, 0x01)
+			expectV(t, c, 0xF, 1)
+		},
+	},
+	{
+		name:  "8FY4 leaves the carry in VF, not the sum",
+		code:  []uint8{0x8F, 0x14},
+		setup: func(c *CHIP8) { c.V[0xF], c.V[1] = 0x01, 0x01 },
+		check: func(t *testing.T, c *CHIP8) { expectV(t, c, 0xF, 0) },
+	},
+	{
+		name:  "8XY5 subtracts without borrow",
+		code:  []uint8{0x81, 0x25},
+		setup: func(c *CHIP8) { c.V[1], c.V[2] = 0x30, 0x10 },
+		check: func(t *testing.T, c *CHIP8) {
+			expectV(t, c, 1, 0x20)
+			expectV(t, c, 0xF, 1)
+		},
+	},
+	{
+		name:  "8XY5 of equal values doesn't borrow",
+		code:  []uint8{0x81, 0x25},
+		setup: func(c *CHIP8) { c.V[1], c.V[2] = 0x30, 0x30 },
+		check: func(t *testing.T, c *CHIP8) {
+			expectV(t, c, 1, 0x00)
+			expectV(t, c, 0xF, 1)
+		},
+	},
+	{
+		name:  "8XY5 clears VF on borrow",
+		code:  []uint8{0x81, 0x25},
+		setup: func(c *CHIP8) { c.V[1], c.V[2] = 0x10, 0x30 },
+		check: func(t *testing.T, c *CHIP8) {
+			expectV(t, c, 1, 0xE0)
+			expectV(t, c, 0xF, 0)
+		},
+	},
+	{
+		name:  "8FY5 leaves the borrow flag in VF, not the difference",
+		code:  []uint8{0x8F, 0x15},
+		setup: func(c *CHIP8) { c.V[0xF], c.V[1] = 0x05, 0x03 },
+		check: func(t *testing.T, c *CHIP8) { expectV(t, c, 0xF, 1) },
+	},
+	{
+		name:  "8XY7 subtracts VX from VY without borrow",
+		code:  []uint8{0x81, 0x27},
+		setup: func(c *CHIP8) { c.V[1], c.V[2] = 0x10, 0x30 },
+		check: func(t *testing.T, c *CHIP8) {
+			expectV(t, c, 1, 0x20)
+			expectV(t, c, 0xF, 1)
+		},
+	},
+	{
+		name:  "8XY7 clears VF on borrow",
+		code:  []uint8{0x81, 0x27},
+		setup: func(c *CHIP8) { c.V[1], c.V[2] = 0x30, 0x10 },
+		check: func(t *testing.T, c *CHIP8) {
+			expectV(t, c, 1, 0xE0)
+			expectV(t, c, 0xF, 0)
+		},
+	},
+	{
+		name:  "8FY7 leaves the borrow flag in VF, not the difference",
+		code:  []uint8{0x8F, 0x17},
+		setup: func(c *CHIP8) { c.V[0xF], c.V[1] = 0x03, 0x05 },
+		check: func(t *testing.T, c *CHIP8) { expectV(t, c, 0xF, 1) },
+	},
+
+	// Shifts, with and without the shifting quirk
+	{
+		name:  "8XY6 shifts VY into VX",
+		code:  []uint8{0x81, 0x26},
+		setup: func(c *CHIP8) { c.V[1], c.V[2] = 0x80, 0x05 },
+		check: func(t *testing.T, c *CHIP8) {
+			expectV(t, c, 1, 0x02)
+			expectV(t, c, 2, 0x05)
+			expectV(t, c, 0xF, 1)
+		},
+	},
+	{
+		name:   "8XY6 with the shifting quirk shifts VX in place",
+		quirks: Quirks{Shifting: true},
+		code:   []uint8{0x81, 0x26},
+		setup:  func(c *CHIP8) { c.V[1], c.V[2] = 0x80, 0x05 },
+		check: func(t *testing.T, c *CHIP8) {
+			expectV(t, c, 1, 0x40)
+			expectV(t, c, 0xF, 0)
+		},
+	},
+	{
+		name:  "8FY6 leaves the shifted out bit in VF, not the result",
+		code:  []uint8{0x8F, 0x16},
+		setup: func(c *CHIP8) { c.V[1] = 0x05 },
+		check: func(t *testing.T, c *CHIP8) { expectV(t, c, 0xF, 1) },
+	},
+	{
+		name:   "8FY6 with the shifting quirk leaves the shifted out bit in VF",
+		quirks: Quirks{Shifting: true},
+		code:   []uint8{0x8F, 0x16},
+		setup:  func(c *CHIP8) { c.V[0xF] = 0x02 },
+		check:  func(t *testing.T, c *CHIP8) { expectV(t, c, 0xF, 0) },
+	},
+	{
+		name:  "8XYE shifts VY into VX",
+		code:  []uint8{0x81, 0x2E},
+		setup: func(c *CHIP8) { c.V[1], c.V[2] = 0x01, 0x81 },
+		check: func(t *testing.T, c *CHIP8) {
+			expectV(t, c, 1, 0x02)
+			expectV(t, c, 2, 0x81)
+			expectV(t, c, 0xF, 1)
+		},
+	},
+	{
+		name:   "8XYE with the shifting quirk takes the carry from VX, not VY",
+		quirks: Quirks{Shifting: true},
+		code:   []uint8{0x81, 0x2E},
+		setup:  func(c *CHIP8) { c.V[1], c.V[2] = 0x01, 0x80 },
+		check: func(t *testing.T, c *CHIP8) {
+			expectV(t, c, 1, 0x02)
+			expectV(t, c, 0xF, 0)
+		},
+	},
+	{
+		name:   "8XYE with the shifting quirk sets VF from bit 7 of VX",
+		quirks: Quirks{Shifting: true},
+		code:   []uint8{0x81, 0x2E},
+		setup:  func(c *CHIP8) { c.V[1], c.V[2] = 0x81, 0x00 },
+		check: func(t *testing.T, c *CHIP8) {
+			expectV(t, c, 1, 0x02)
+			expectV(t, c, 0xF, 1)
+		},
+	},
+	{
+		name:  "8FYE leaves the shifted out bit in VF, not the result",
+		code:  []uint8{0x8F, 0x1E},
+		setup: func(c *CHIP8) { c.V[1] = 0x40 },
+		check: func(t *testing.T, c *CHIP8) { expectV(t, c, 0xF, 0) },
+	},
+	{
+		name:   "8FYE with the shifting quirk leaves the shifted out bit in VF",
+		quirks: Quirks{Shifting: true},
+		code:   []uint8{0x8F, 0x1E},
+		setup:  func(c *CHIP8) { c.V[0xF] = 0x81 },
+		check:  func(t *testing.T, c *CHIP8) { expectV(t, c, 0xF, 1) },
+	},
+	{
+		name: "8XY8 is illegal",
+		code: []uint8{0x81, 0x28},
+		err:  ErrIllegalOpcode,
+	},
+
+	// Index register and random
+	{
+		name:  "ANNN loads I",
+		code:  []uint8{0xA1, 0x23},
+		check: func(t *testing.T, c *CHIP8) { expect(t, "I", c.I, 0x123) },
+	},
+	{
+		name:  "CXNN masks a random byte with NN",
+		code:  []uint8{0xC1, 0x0F},
+		check: func(t *testing.T, c *CHIP8) { expectV(t, c, 1, 0x0B) },
+	},
+	{
+		name:  "FX1E adds VX to I without touching VF",
+		code:  []uint8{0xF1, 0x1E},
+		setup: func(c *CHIP8) { c.I, c.V[1], c.V[0xF] = 0xFFF, 0x02, 0x55 },
+		check: func(t *testing.T, c *CHIP8) {
+			expect(t, "I", c.I, 0x1001)
+			expectV(t, c, 0xF, 0x55)
+		},
+	},
+	{
+		name:  "FX29 points I at the small font digit in VX",
+		code:  []uint8{0xF1, 0x29},
+		setup: func(c *CHIP8) { c.V[1] = 0x1A },
+		check: func(t *testing.T, c *CHIP8) { expect(t, "I", c.I, fontAddress+0xA*5) },
+	},
+	{
+		name:      "FX30 points I at the big font digit in VX",
+		extension: SUPERCHIP,
+		code:      []uint8{0xF1, 0x30},
+		setup:     func(c *CHIP8) { c.V[1] = 0x3 },
+		check:     func(t *testing.T, c *CHIP8) { expect(t, "I", c.I, bigFontAddress+3*10) },
+	},
+	{
+		name: "FX30 is illegal on CHIP-8",
+		code: []uint8{0xF1, 0x30},
+		err:  ErrIllegalOpcode,
+	},
+
+	// Timers
+	{
+		name:  "FX07 reads the delay timer",
+		code:  []uint8{0xF1, 0x07},
+		setup: func(c *CHIP8) { c.delayTimer = 0x42 },
+		check: func(t *testing.T, c *CHIP8) { expectV(t, c, 1, 0x42) },
+	},
+	{
+		name:  "FX15 sets the delay timer",
+		code:  []uint8{0xF1, 0x15},
+		setup: func(c *CHIP8) { c.V[1] = 0x42 },
+		check: func(t *testing.T, c *CHIP8) { expect(t, "delay timer", c.delayTimer, 0x42) },
+	},
+	{
+		name:  "FX18 sets the sound timer",
+		code:  []uint8{0xF1, 0x18},
+		setup: func(c *CHIP8) { c.V[1] = 0x42 },
+		check: func(t *testing.T, c *CHIP8) { expect(t, "sound timer", c.soundTimer, 0x42) },
+	},
+
+	// Memory
+	{
+		name:  "FX33 stores the BCD of VX",
+		code:  []uint8{0xF1, 0x33},
+		setup: func(c *CHIP8) { c.I, c.V[1] = 0x300, 254 },
+		check: func(t *testing.T, c *CHIP8) {
+			expect(t, "BCD", [3]uint8(c.ram[0x300:0x303]), [3]uint8{2, 5, 4})
+			expect(t, "I", c.I, 0x300)
+		},
+	},
+	{
+		name:  "FX55 stores V0-VX and leaves I",
+		code:  []uint8{0xF2, 0x55},
+		setup: func(c *CHIP8) { c.I, c.V[0], c.V[1], c.V[2], c.V[3] = 0x300, 1, 2, 3, 4 },
+		check: func(t *testing.T, c *CHIP8) {
+			expect(t, "memory", [4]uint8(c.ram[0x300:0x304]), [4]uint8{1, 2, 3, 0})
+			expect(t, "I", c.I, 0x300)
+		},
+	},
+	{
+		name:   "FX55 with the memory increment quirk advances I by X+1",
+		quirks: Quirks{MemoryIncrement: true},
+		code:   []uint8{0xF2, 0x55},
+		setup:  func(c *CHIP8) { c.I = 0x300 },
+		check:  func(t *testing.T, c *CHIP8) { expect(t, "I", c.I, 0x303) },
+	},
+	{
+		name:   "FX55 with the increment by X quirk advances I by X",
+		quirks: Quirks{MemoryIncrement: true, MemoryIncrementByX: true},
+		code:   []uint8{0xF2, 0x55},
+		setup:  func(c *CHIP8) { c.I = 0x300 },
+		check:  func(t *testing.T, c *CHIP8) { expect(t, "I", c.I, 0x302) },
+	},
+	{
+		name:  "FX55 past the end of RAM faults",
+		code:  []uint8{0xF2, 0x55},
+		setup: func(c *CHIP8) { c.I = 0xFFF },
+		err:   ErrMemoryOutOfBounds,
+		check: func(t *testing.T, c *CHIP8) { expect(t, "fault address", c.Fault().Address, 0x1000) },
+	},
+	{
+		name:  "FX65 loads V0-VX and leaves I",
+		code:  []uint8{0xF2, 0x65},
+		setup: func(c *CHIP8) { c.I = 0x300; copy(c.ram[0x300:], []uint8{1, 2, 3, 4}) },
+		check: func(t *testing.T, c *CHIP8) {
+			expect(t, "V0-V3", [4]uint8(c.V[:4]), [4]uint8{1, 2, 3, 0})
+			expect(t, "I", c.I, 0x300)
+		},
+	},
+	{
+		name:   "FX65 with the memory increment quirk advances I by X+1",
+		quirks: Quirks{MemoryIncrement: true},
+		code:   []uint8{0xF2, 0x65},
+		setup:  func(c *CHIP8) { c.I = 0x300 },
+		check:  func(t *testing.T, c *CHIP8) { expect(t, "I", c.I, 0x303) },
+	},
+	{
+		name:   "FX65 with the increment by X quirk advances I by X",
+		quirks: Quirks{MemoryIncrement: true, MemoryIncrementByX: true},
+		code:   []uint8{0xF2, 0x65},
+		setup:  func(c *CHIP8) { c.I = 0x300 },
+		check:  func(t *testing.T, c *CHIP8) { expect(t, "I", c.I, 0x302) },
+	},
+	{
+		name:      "FX75 saves V0-VX to the RPL flags",
+		extension: SUPERCHIP,
+		code:      []uint8{0xF1, 0x75},
+		setup:     func(c *CHIP8) { c.V[0], c.V[1], c.V[2] = 1, 2, 3 },
+		check: func(t *testing.T, c *CHIP8) {
+			expect(t, "RPL", [3]uint8(c.rpl[:3]), [3]uint8{1, 2, 0})
+		},
+	},
+	{
+		name:      "FX85 loads V0-VX from the RPL flags",
+		extension: SUPERCHIP,
+		code:      []uint8{0xF1, 0x85},
+		setup:     func(c *CHIP8) { c.rpl[0], c.rpl[1], c.rpl[2] = 1, 2, 3 },
+		check: func(t *testing.T, c *CHIP8) {
+			expect(t, "V0-V2", [3]uint8(c.V[:3]), [3]uint8{1, 2, 0})
+		},
+	},
+	{
+		name: "FX75 is illegal on CHIP-8",
+		code: []uint8{0xF1, 0x75},
+		err:  ErrIllegalOpcode,
+	},
+	{
+		name: "FX85 is illegal on CHIP-8",
+		code: []uint8{0xF1, 0x85},
+		err:  ErrIllegalOpcode,
+	},
+	{
+		name: "FX99 is illegal",
+		code: []uint8{0xF1, 0x99},
+		err:  ErrIllegalOpcode,
+	},
+
+	// XO-CHIP
+	{
+		name:      "5XY2 saves VX-VY",
+		extension: XOCHIP,
+		code:      []uint8{0x51, 0x32},
+		setup:     func(c *CHIP8) { c.I, c.V[1], c.V[2], c.V[3] = 0x300, 1, 2, 3 },
+		check: func(t *testing.T, c *CHIP8) {
+			expect(t, "memory", [3]uint8(c.ram[0x300:0x303]), [3]uint8{1, 2, 3})
+			expect(t, "I", c.I, 0x300)
+		},
+	},
+	{
+		name:      "5XY2 with X > Y saves in reverse order",
+		extension: XOCHIP,
+		code:      []uint8{0x53, 0x12},
+		setup:     func(c *CHIP8) { c.I, c.V[1], c.V[2], c.V[3] = 0x300, 1, 2, 3 },
+		check: func(t *testing.T, c *CHIP8) {
+			expect(t, "memory", [3]uint8(c.ram[0x300:0x303]), [3]uint8{3, 2, 1})
+		},
+	},
+	{
+		name:      "5XY3 loads VX-VY",
+		extension: XOCHIP,
+		code:      []uint8{0x51, 0x33},
+		setup:     func(c *CHIP8) { c.I = 0x300; copy(c.ram[0x300:], []uint8{1, 2, 3}) },
+		check: func(t *testing.T, c *CHIP8) {
+			expect(t, "V1-V3", [3]uint8(c.V[1:4]), [3]uint8{1, 2, 3})
+			expect(t, "I", c.I, 0x300)
+		},
+	},
+	{
+		name:      "5XY3 with X > Y loads in reverse order",
+		extension: XOCHIP,
+		code:      []uint8{0x53, 0x13},
+		setup:     func(c *CHIP8) { c.I = 0x300; copy(c.ram[0x300:], []uint8{1, 2, 3}) },
+		check: func(t *testing.T, c *CHIP8) {
+			expect(t, "V1-V3", [3]uint8(c.V[1:4]), [3]uint8{3, 2, 1})
+		},
+	},
+	{
+		name:      "5XY2 is illegal on SUPER-CHIP",
+		extension: SUPERCHIP,
+		code:      []uint8{0x51, 0x32},
+		err:       ErrIllegalOpcode,
+	},
+	{
+		name: "5XY3 is illegal on CHIP-8",
+		code: []uint8{0x51, 0x33},
+		err:  ErrIllegalOpcode,
+	},
+	{
+		name:      "F000 NNNN loads a 16 bit address into I",
+		extension: XOCHIP,
+		code:      []uint8{0xF0, 0x00, 0xAB, 0xCD},
+		check: func(t *testing.T, c *CHIP8) {
+			expect(t, "I", c.I, 0xABCD)
+			expectPC(t, c, 0x204)
+		},
+	},
+	{
+		name: "F000 is illegal on CHIP-8",
+		code: []uint8{0xF0, 0x00, 0xAB, 0xCD},
+		err:  ErrIllegalOpcode,
+	},
+	{
+		name:      "FN01 selects bitplanes",
+		extension: XOCHIP,
+		code:      []uint8{0xF2, 0x01},
+		check:     func(t *testing.T, c *CHIP8) { expect(t, "planes", c.planes, 0x2) },
+	},
+	{
+		name:      "FN01 with N > 3 is illegal",
+		extension: XOCHIP,
+		code:      []uint8{0xF4, 0x01},
+		err:       ErrIllegalOpcode,
+	},
+	{
+		name:      "F002 loads the audio pattern",
+		extension: XOCHIP,
+		code:      []uint8{0xF0, 0x02},
+		setup: func(c *CHIP8) {
+			c.I = 0x300
+			for i := range 16 {
+				c.ram[0x300+i] = uint8(i)
+			}
+		},
+		check: func(t *testing.T, c *CHIP8) {
+			pattern, _, ok := c.AudioPattern()
+			expect(t, "pattern", pattern, [16]uint8{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15})
+			expect(t, "has pattern", ok, true)
+		},
+	},
+	{
+		name:      "FX3A sets the pitch",
+		extension: XOCHIP,
+		code:      []uint8{0xF1, 0x3A},
+		setup:     func(c *CHIP8) { c.V[1] = 112 },
+		check: func(t *testing.T, c *CHIP8) {
+			_, rate, _ := c.AudioPattern()
+			expect(t, "rate", rate, 8000.0)
+		},
+	},
+	{
+		name: "FX3A is illegal on CHIP-8",
+		code: []uint8{0xF1, 0x3A},
+		err:  ErrIllegalOpcode,
+	},
+
+	// DXYN
+	{
+		name: "DXYN draws a sprite",
+		code: []uint8{0xD0, 0x15},
+		setup: func(c *CHIP8) {
+			c.V[0], c.V[1] = 2, 3
+			c.I = fontAddress // 0: F0 90 90 90 F0
+		},
+		check: func(t *testing.T, c *CHIP8) {
+			expectPixel(t, c, 2, 3, 1)
+			expectPixel(t, c, 5, 3, 1)
+			expectPixel(t, c, 6, 3, 0)
+			expectPixel(t, c, 3, 4, 0)
+			expectPixel(t, c, 5, 7, 1)
+			expectV(t, c, 0xF, 0)
+		},
+	},
+	{
+		name: "DXYN sets VF when it erases a pixel",
+		code: []uint8{0xD0, 0x11},
+		setup: func(c *CHIP8) {
+			lit(c, 0, 0)
+			c.V[0xF] = 0x55
+		},
+		check: func(t *testing.T, c *CHIP8) {
+			expectPixel(t, c, 0, 0, 0)
+			expectPixel(t, c, 1, 0, 1)
+			expectV(t, c, 0xF, 1)
+		},
+	},
+	{
+		name: "DXYN wraps the start position",
+		code: []uint8{0xD0, 0x11},
+		setup: func(c *CHIP8) {
+			c.V[0], c.V[1] = 66, 33
+		},
+		check: func(t *testing.T, c *CHIP8) {
+			expectPixel(t, c, 2, 1, 1)
+		},
+	},
+	{
+		name:   "DXYN with the clipping quirk clips at the edges",
+		quirks: Quirks{Clipping: true},
+		code:   []uint8{0xD0, 0x12},
+		setup: func(c *CHIP8) {
+			c.V[0], c.V[1] = 62, 31
+			c.I = 0x300
+			c.ram[0x300], c.ram[0x301] = 0xFF, 0xFF
+		},
+		check: func(t *testing.T, c *CHIP8) {
+			expectPixel(t, c, 62, 31, 1)
+			expectPixel(t, c, 63, 31, 1)
+			expectPixel(t, c, 0, 31, 0)
+			expectPixel(t, c, 62, 0, 0)
+		},
+	},
+	{
+		name: "DXYN without the clipping quirk wraps around the edges",
+		code: []uint8{0xD0, 0x12},
+		setup: func(c *CHIP8) {
+			c.V[0], c.V[1] = 62, 31
+			c.I = 0x300
+			c.ram[0x300], c.ram[0x301] = 0xFF, 0xFF
+		},
+		check: func(t *testing.T, c *CHIP8) {
+			expectPixel(t, c, 63, 31, 1)
+			expectPixel(t, c, 5, 31, 1)
+			expectPixel(t, c, 62, 0, 1)
+			expectPixel(t, c, 5, 0, 1)
+		},
+	},
+	{
+		name:   "DXYN with the display wait quirk waits for the next frame",
+		quirks: Quirks{DisplayWait: true},
+		code:   []uint8{0xD0, 0x11},
+		check:  func(t *testing.T, c *CHIP8) { expect(t, "vblank wait", c.vblankWait, true) },
+	},
+	{
+		name:      "DXYN with the display wait quirk doesn't wait in hires",
+		extension: SUPERCHIP,
+		quirks:    Quirks{DisplayWait: true},
+		code:      []uint8{0xD0, 0x11},
+		setup:     func(c *CHIP8) { c.setHires(true) },
+		check:     func(t *testing.T, c *CHIP8) { expect(t, "vblank wait", c.vblankWait, false) },
+	},
+	{
+		name:      "DXY0 draws a 16x16 sprite on SUPER-CHIP",
+		extension: SUPERCHIP,
+		code:      []uint8{0xD0, 0x10},
+		setup: func(c *CHIP8) {
+			c.setHires(true)
+			c.I = 0x300
+			for i := range 32 {
+				c.ram[0x300+i] = 0xFF
+			}
+		},
+		check: func(t *testing.T, c *CHIP8) {
+			expectPixel(t, c, 15, 15, 1)
+			expectPixel(t, c, 16, 0, 0)
+			expectPixel(t, c, 0, 16, 0)
+		},
+	},
+	{
+		name:  "DXY0 draws nothing on CHIP-8",
+		code:  []uint8{0xD0, 0x10},
+		setup: func(c *CHIP8) { c.I = 0x300; c.ram[0x300] = 0xFF },
+		check: func(t *testing.T, c *CHIP8) { expectPixel(t, c, 0, 0, 0) },
+	},
+	{
+		name:      "DXYN with the row collisions quirk counts colliding rows in hires",
+		extension: SUPERCHIP,
+		quirks:    Quirks{RowCollisions: true},
+		code:      []uint8{0xD0, 0x14},
+		setup: func(c *CHIP8) {
+			c.setHires(true)
+			lit(c, 0, 1)
+			lit(c, 0, 2)
+			c.I = 0x300
+			copy(c.ram[0x300:], []uint8{0x80, 0x80, 0x80, 0x80})
+		},
+		check: func(t *testing.T, c *CHIP8) { expectV(t, c, 0xF, 2) },
+	},
+	{
+		name:      "DXYN with the row collisions quirk counts rows clipped at the bottom",
+		extension: SUPERCHIP,
+		quirks:    Quirks{RowCollisions: true, Clipping: true},
+		code:      []uint8{0xD0, 0x14},
+		setup: func(c *CHIP8) {
+			c.setHires(true)
+			c.V[1] = 62
+			c.I = 0x300
+		},
+		check: func(t *testing.T, c *CHIP8) { expectV(t, c, 0xF, 2) },
+	},
+	{
+		name:      "DXYN with the row collisions quirk only sets VF to 1 in lores",
+		extension: SUPERCHIP,
+		quirks:    Quirks{RowCollisions: true},
+		code:      []uint8{0xD0, 0x12},
+		setup: func(c *CHIP8) {
+			lit(c, 0, 0)
+			lit(c, 0, 1)
+			c.I = 0x300
+			copy(c.ram[0x300:], []uint8{0x80, 0x80})
+		},
+		check: func(t *testing.T, c *CHIP8) { expectV(t, c, 0xF, 1) },
+	},
+	{
+		name:      "DXYN draws one sprite per selected plane on XO-CHIP",
+		extension: XOCHIP,
+		code:      []uint8{0xD0, 0x11},
+		setup: func(c *CHIP8) {
+			c.planes = 0x3
+			c.I = 0x300
+			c.ram[0x300], c.ram[0x301] = 0x80, 0x40
+		},
+		check: func(t *testing.T, c *CHIP8) {
+			expectPixel(t, c, 0, 0, 0x1)
+			expectPixel(t, c, 1, 0, 0x2)
+		},
+	},
+	{
+		name:      "DXYN draws plane 2 from the first sprite when only it is selected",
+		extension: XOCHIP,
+		code:      []uint8{0xD0, 0x11},
+		setup: func(c *CHIP8) {
+			c.planes = 0x2
+			c.I = 0x300
+			c.ram[0x300], c.ram[0x301] = 0x80, 0x40
+		},
+		check: func(t *testing.T, c *CHIP8) {
+			expectPixel(t, c, 0, 0, 0x2)
+			expectPixel(t, c, 1, 0, 0)
+		},
+	},
+	{
+		name:  "DXYN reading past the end of RAM faults",
+		code:  []uint8{0xD0, 0x12},
+		setup: func(c *CHIP8) { c.I = 0xFFF },
+		err:   ErrMemoryOutOfBounds,
+	},
+}
+
+func TestOpcodes(t *testing.T) {
+	for _, tt := range opcodeTests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestMachine(tt.extension, tt.quirks, tt.code)
+			if tt.setup != nil {
+				tt.setup(c)
+			}
+
+			err := c.ExecuteInstruction()
+
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("err = %v, want %v", err, tt.err)
+				}
+				var fault *Fault
+				if !errors.As(err, &fault) {
+					t.Fatalf("err = %T, want *Fault", err)
+				}
+				expect(t, "state", c.State(), FAULTED)
+				expectPC(t, c, EntryPoint)
+			} else if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+
+			if tt.check != nil {
+				tt.check(t, c)
+			}
+		})
+	}
+}
+
+func TestFX0AWaitsForPressAndRelease(t *testing.T) {
+	c := newTestMachine(CHIP_8, vip, []uint8{0xF3, 0x0A})
+
+	step := func(what string, pc uint16) {
+		t.Helper()
+		if err := c.ExecuteInstruction(); err != nil {
+			t.Fatal(err)
+		}
+		expect(t, "PC "+what, c.PC, pc)
+	}
+
+	step("with no key", 0x200)
+	c.SetKey(0x7, true)
+	step("while the key is held", 0x200)
+	step("while the key is still held", 0x200)
+	c.SetKey(0x7, false)
+	step("after the release", 0x202)
+	expectV(t, c, 3, 0x7)
+}
+
+func TestFX0AIgnoresOtherKeysReleased(t *testing.T) {
+	c := newTestMachine(CHIP_8, vip, []uint8{0xF3, 0x0A})
+
+	c.SetKey(0x7, true)
+	c.ExecuteInstruction()
+	c.SetKey(0x2, true)
+	c.ExecuteInstruction()
+	c.SetKey(0x2, false)
+	c.ExecuteInstruction()
+	expectPC(t, c, 0x200)
+
+	c.SetKey(0x7, false)
+	c.ExecuteInstruction()
+	expectPC(t, c, 0x202)
+	expectV(t, c, 3, 0x7)
+}
+
+func TestFetchPastEndOfRAMFaults(t *testing.T) {
+	c := newTestMachine(CHIP_8, vip, nil)
+	c.PC = 0xFFF
+
+	err := c.ExecuteInstruction()
+	if !errors.Is(err, ErrMemoryOutOfBounds) {
+		t.Fatalf("err = %v, want %v", err, ErrMemoryOutOfBounds)
+	}
+	expect(t, "fault address", c.Fault().Address, 0x1000)
+}
+
+// A fault mid-frame still pays the previous frame's cycle debt, so the next
+// frame isn't charged for it again.
+func TestVIPFrameFaultSettlesCycleDebt(t *testing.T) {
+	c := newTestMachine(CHIP_8, vip, []uint8{0x00, 0xEE})
+	c.cycleDebt = -100
+
+	err := c.RunVIPFrame()
+	if !errors.Is(err, ErrStackUnderflow) {
+		t.Fatalf("err = %v, want %v", err, ErrStackUnderflow)
+	}
+	expect(t, "cycle debt", c.cycleDebt, 0)
+
+	// Overspending on the faulting instruction carries over like any other
+	c = newTestMachine(CHIP_8, vip, []uint8{0x00, 0xEE})
+	c.cycleDebt = 1 - vipCPUFrameCycles
+	want := 1 - c.vipCycles(0x00EE)
+	if err := c.RunVIPFrame(); !errors.Is(err, ErrStackUnderflow) {
+		t.Fatalf("err = %v, want %v", err, ErrStackUnderflow)
+	}
+	expect(t, "cycle debt", c.cycleDebt, want)
+}
+
+// Every opcode a platform defines must either run or raise ErrIllegalOpcode,
+// never panic or fail another way from a clean machine.
+func TestEveryOpcodeRunsOrIsIllegal(t *testing.T) {
+	for _, extension := range []Extension{CHIP_8, SUPERCHIP, XOCHIP} {
+		for opcode := range 0x10000 {
+			c := newTestMachine(extension, DefaultProfile(extension).Quirks, []uint8{uint8(opcode >> 8), uint8(opcode)})
+			c.stackPointer = 1
+
+			err := c.ExecuteInstruction()
+			if err != nil && !errors.Is(err, ErrIllegalOpcode) {
+				t.Errorf("%v %04X: %v", extension, opcode, err)
+			}
+		}
+	}
+}
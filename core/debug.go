@@ -0,0 +1,77 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// ErrBreak is returned by RunFrame and RunVIPFrame when a breakpoint, or the
+// condition set with BreakWhen, stops the machine in front of an instruction.
+// The machine stays RUNNING; the rest of the frame is skipped.
+var ErrBreak = errors.New("break")
+
+// SetBreakpoint stops execution whenever PC reaches addr.
+func (chip8 *CHIP8) SetBreakpoint(addr uint16) {
+	if chip8.breakpoints == nil {
+		chip8.breakpoints = map[uint16]bool{}
+	}
+	chip8.breakpoints[addr] = true
+}
+
+func (chip8 *CHIP8) ClearBreakpoint(addr uint16) {
+	delete(chip8.breakpoints, addr)
+}
+
+// Breakpoints returns the breakpoint addresses in ascending order.
+func (chip8 *CHIP8) Breakpoints() []uint16 {
+	addrs := make([]uint16, 0, len(chip8.breakpoints))
+	for addr := range chip8.breakpoints {
+		addrs = append(addrs, addr)
+	}
+	slices.Sort(addrs)
+	return addrs
+}
+
+// BreakWhen stops execution in front of the first instruction for which cond
+// returns true. The condition is dropped after any break; nil removes it.
+func (chip8 *CHIP8) BreakWhen(cond func() bool) {
+	chip8.breakWhen = cond
+}
+
+// Resume lets the next instruction run even if it sits on a breakpoint, so
+// execution can continue after a break.
+func (chip8 *CHIP8) Resume() {
+	chip8.resume = true
+}
+
+// Memory returns the platform's addressable RAM. The slice aliases the
+// machine and must not be modified.
+func (chip8 *CHIP8) Memory() []uint8 {
+	return chip8.ram[:chip8.memorySize()]
+}
+
+// WriteMemory copies data into RAM at addr, for debuggers. Nothing is written
+// unless all of it fits.
+func (chip8 *CHIP8) WriteMemory(addr int, data []uint8) error {
+	if addr < 0 || addr+len(data) > chip8.memorySize() {
+		return fmt.Errorf("%w: 0x%04X", ErrMemoryOutOfBounds, addr+len(data)-1)
+	}
+	copy(chip8.ram[addr:], data)
+	return nil
+}
+
+// shouldBreak reports whether execution has to stop before the instruction at PC.
+func (chip8 *CHIP8) shouldBreak() bool {
+	if chip8.resume {
+		chip8.resume = false
+		return false
+	}
+
+	if chip8.breakpoints[chip8.PC] || (chip8.breakWhen != nil && chip8.breakWhen()) {
+		chip8.breakWhen = nil
+		return true
+	}
+
+	return false
+}
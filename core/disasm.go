@@ -0,0 +1,343 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// aluMnemonics names the 8XYN register operations by N.
+var aluMnemonics = map[uint8]string{
+	0x0: "LD", 0x1: "OR", 0x2: "AND", 0x3: "XOR", 0x4: "ADD",
+	0x5: "SUB", 0x6: "SHR", 0x7: "SUBN", 0xE: "SHL",
+}
+
+// Mnemonic returns the assembly for the instruction at the start of code and
+// its size in bytes, or ok false when it is not valid on extension. Only the
+// XO-CHIP F000 NNNN instruction is 4 bytes long. With the jumping quirk BXNN
+// is shown as JP VX, XNN.
+func Mnemonic(code []uint8, extension Extension, quirks Quirks) (text string, size int, ok bool) {
+	return mnemonic(code, extension, quirks, func(addr uint16) string {
+		return fmt.Sprintf("0x%03X", addr)
+	})
+}
+
+// mnemonic is Mnemonic with target formatting the address operands of
+// jumps and calls.
+func mnemonic(code []uint8, extension Extension, quirks Quirks, target func(uint16) string) (string, int, bool) {
+	if len(code) < 2 {
+		return "", 0, false
+	}
+
+	inst := decode(uint16(code[0])<<8 | uint16(code[1]))
+	x, y := inst.X, inst.Y
+	schip := extension != CHIP_8
+	xochip := extension == XOCHIP
+
+	switch inst.opcode >> 12 {
+	case 0x0:
+		switch {
+		case inst.NNN == 0x0E0:
+			return "CLS", 2, true
+		case inst.NNN == 0x0EE:
+			return "RET", 2, true
+		case schip && inst.NNN&0xFF0 == 0x0C0:
+			return fmt.Sprintf("SCD %d", inst.N), 2, true
+		case xochip && inst.NNN&0xFF0 == 0x0D0:
+			return fmt.Sprintf("SCU %d", inst.N), 2, true
+		case schip && inst.NNN == 0x0FB:
+			return "SCR", 2, true
+		case schip && inst.NNN == 0x0FC:
+			return "SCL", 2, true
+		case schip && inst.NNN == 0x0FD:
+			return "EXIT", 2, true
+		case schip && inst.NNN == 0x0FE:
+			return "LOW", 2, true
+		case schip && inst.NNN == 0x0FF:
+			return "HIGH", 2, true
+		}
+	case 0x1:
+		return "JP " + target(inst.NNN), 2, true
+	case 0x2:
+		return "CALL " + target(inst.NNN), 2, true
+	case 0x3:
+		return fmt.Sprintf("SE V%X, 0x%02X", x, inst.NN), 2, true
+	case 0x4:
+		return fmt.Sprintf("SNE V%X, 0x%02X", x, inst.NN), 2, true
+	case 0x5:
+		switch {
+		case inst.N == 0:
+			return fmt.Sprintf("SE V%X, V%X", x, y), 2, true
+		case xochip && inst.N == 2:
+			return fmt.Sprintf("SAVE V%X, V%X", x, y), 2, true
+		case xochip && inst.N == 3:
+			return fmt.Sprintf("LOAD V%X, V%X", x, y), 2, true
+		}
+	case 0x6:
+		return fmt.Sprintf("LD V%X, 0x%02X", x, inst.NN), 2, true
+	case 0x7:
+		return fmt.Sprintf("ADD V%X, 0x%02X", x, inst.NN), 2, true
+	case 0x8:
+		if op, ok := aluMnemonics[inst.N]; ok {
+			return fmt.Sprintf("%s V%X, V%X", op, x, y), 2, true
+		}
+	case 0x9:
+		if inst.N == 0 {
+			return fmt.Sprintf("SNE V%X, V%X", x, y), 2, true
+		}
+	case 0xA:
+		return fmt.Sprintf("LD I, 0x%03X", inst.NNN), 2, true
+	case 0xB:
+		if quirks.Jumping {
+			return fmt.Sprintf("JP V%X, %s", x, target(inst.NNN)), 2, true
+		}
+		return "JP V0, " + target(inst.NNN), 2, true
+	case 0xC:
+		return fmt.Sprintf("RND V%X, 0x%02X", x, inst.NN), 2, true
+	case 0xD:
+		return fmt.Sprintf("DRW V%X, V%X, %d", x, y, inst.N), 2, true
+	case 0xE:
+		switch inst.NN {
+		case 0x9E:
+			return fmt.Sprintf("SKP V%X", x), 2, true
+		case 0xA1:
+			return fmt.Sprintf("SKNP V%X", x), 2, true
+		}
+	case 0xF:
+		switch inst.NN {
+		case 0x00:
+			if xochip && x == 0 && len(code) >= 4 {
+				return fmt.Sprintf("LD I, LONG 0x%04X", uint16(code[2])<<8|uint16(code[3])), 4, true
+			}
+		case 0x01:
+			if xochip && x <= 3 {
+				return fmt.Sprintf("PLANE %d", x), 2, true
+			}
+		case 0x02:
+			if xochip && x == 0 {
+				return "AUDIO", 2, true
+			}
+		case 0x3A:
+			if xochip {
+				return fmt.Sprintf("PITCH V%X", x), 2, true
+			}
+		case 0x07:
+			return fmt.Sprintf("LD V%X, DT", x), 2, true
+		case 0x0A:
+			return fmt.Sprintf("LD V%X, K", x), 2, true
+		case 0x15:
+			return fmt.Sprintf("LD DT, V%X", x), 2, true
+		case 0x18:
+			return fmt.Sprintf("LD ST, V%X", x), 2, true
+		case 0x1E:
+			return fmt.Sprintf("ADD I, V%X", x), 2, true
+		case 0x29:
+			return fmt.Sprintf("LD F, V%X", x), 2, true
+		case 0x30:
+			if schip {
+				return fmt.Sprintf("LD HF, V%X", x), 2, true
+			}
+		case 0x33:
+			return fmt.Sprintf("LD B, V%X", x), 2, true
+		case 0x55:
+			return fmt.Sprintf("LD [I], V%X", x), 2, true
+		case 0x65:
+			return fmt.Sprintf("LD V%X, [I]", x), 2, true
+		case 0x75:
+			if schip {
+				return fmt.Sprintf("LD R, V%X", x), 2, true
+			}
+		case 0x85:
+			if schip {
+				return fmt.Sprintf("LD V%X, R", x), 2, true
+			}
+		}
+	}
+
+	return "", 0, false
+}
+
+// flow holds the result of tracing a ROM's control flow.
+type flow struct {
+	rom        []uint8
+	entryPoint int
+	extension  Extension
+	quirks     Quirks
+	code       []int          // Instruction size at each instruction start, 0 elsewhere
+	covered    []bool         // Byte belongs to a reachable instruction
+	labels     map[int]string // Jump and call targets inside the ROM
+}
+
+// traceFlow follows every path from the entry point. Bytes never reached as
+// an instruction are data.
+func traceFlow(rom []uint8, entryPoint int, extension Extension, quirks Quirks) *flow {
+	f := &flow{
+		rom:        rom,
+		entryPoint: entryPoint,
+		extension:  extension,
+		quirks:     quirks,
+		code:       make([]int, len(rom)),
+		covered:    make([]bool, len(rom)),
+		labels:     map[int]string{},
+	}
+	noTarget := func(uint16) string { return "" }
+
+	queue := []int{entryPoint}
+	for len(queue) > 0 {
+		addr := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+
+		for {
+			offset := addr - entryPoint
+			if offset < 0 || offset >= len(rom) || f.covered[offset] {
+				break
+			}
+
+			_, size, ok := mnemonic(rom[offset:], extension, quirks, noTarget)
+			if !ok || f.overlaps(offset, size) {
+				break
+			}
+			f.code[offset] = size
+			for i := range size {
+				f.covered[offset+i] = true
+			}
+
+			inst := decode(uint16(rom[offset])<<8 | uint16(rom[offset+1]))
+			next := addr + size
+
+			switch {
+			case inst.opcode == 0x00EE || (extension != CHIP_8 && inst.opcode == 0x00FD):
+				next = -1
+			case inst.opcode>>12 == 0x1:
+				f.label(int(inst.NNN), "L")
+				queue = append(queue, int(inst.NNN))
+				next = -1
+			case inst.opcode>>12 == 0x2:
+				f.label(int(inst.NNN), "S")
+				queue = append(queue, int(inst.NNN))
+			case inst.opcode>>12 == 0xB:
+				// The offset in V0, or VX with the jumping quirk, is unknown, so
+				// only the base of the table is followed
+				f.label(int(inst.NNN), "L")
+				queue = append(queue, int(inst.NNN))
+				next = -1
+			case isSkip(inst):
+				queue = append(queue, next+f.sizeAt(next))
+			}
+
+			if next < 0 {
+				break
+			}
+			addr = next
+		}
+	}
+
+	// Labels pointing into the middle of an instruction can't be placed
+	for addr := range f.labels {
+		if offset := addr - entryPoint; f.code[offset] == 0 && f.covered[offset] {
+			delete(f.labels, addr)
+		}
+	}
+
+	return f
+}
+
+func isSkip(inst Instruction) bool {
+	switch inst.opcode >> 12 {
+	case 0x3, 0x4:
+		return true
+	case 0x5, 0x9:
+		return inst.N == 0
+	case 0xE:
+		return inst.NN == 0x9E || inst.NN == 0xA1
+	}
+	return false
+}
+
+// sizeAt returns the size of the instruction a skip at addr jumps over.
+func (f *flow) sizeAt(addr int) int {
+	offset := addr - f.entryPoint
+	if f.extension == XOCHIP && offset >= 0 && offset+1 < len(f.rom) && f.rom[offset] == 0xF0 && f.rom[offset+1] == 0x00 {
+		return 4
+	}
+	return 2
+}
+
+func (f *flow) overlaps(offset, size int) bool {
+	for i := range size {
+		if offset+i >= len(f.rom) || f.covered[offset+i] {
+			return true
+		}
+	}
+	return false
+}
+
+// label names addr with prefix, unless it is outside the ROM. Subroutine
+// names win over jump labels.
+func (f *flow) label(addr int, prefix string) {
+	if addr < f.entryPoint || addr >= f.entryPoint+len(f.rom) {
+		return
+	}
+	if name, ok := f.labels[addr]; ok && (name[0] == 'S' || prefix == "L") {
+		return
+	}
+	f.labels[addr] = fmt.Sprintf("%s%03X", prefix, addr)
+}
+
+func (f *flow) target(addr uint16) string {
+	if name, ok := f.labels[int(addr)]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%03X", addr)
+}
+
+// Disassemble writes an annotated listing of rom, loaded at entryPoint, to w.
+// Every line shows the address and raw bytes; code reachable from the entry
+// point is shown as mnemonics and everything else as db data. quirks only
+// changes how BNNN reads, see Mnemonic.
+func Disassemble(w io.Writer, rom []uint8, entryPoint int, extension Extension, quirks Quirks) error {
+	f := traceFlow(rom, entryPoint, extension, quirks)
+	out := bufio.NewWriter(w)
+
+	fmt.Fprintf(out, "; %s, %d bytes at 0x%03X\n", extension, len(rom), entryPoint)
+	if quirks.Jumping {
+		fmt.Fprintln(out, "; jumping quirk: JP VX, XNN jumps to XNN + VX")
+	}
+
+	for offset := 0; offset < len(rom); {
+		addr := entryPoint + offset
+		if name, ok := f.labels[addr]; ok {
+			fmt.Fprintf(out, "\n%s:\n", name)
+		}
+
+		if size := f.code[offset]; size > 0 {
+			text, _, _ := mnemonic(rom[offset:], extension, quirks, f.target)
+			raw := fmt.Sprintf("%02X%02X", rom[offset], rom[offset+1])
+			if size == 4 {
+				raw += fmt.Sprintf(" %02X%02X", rom[offset+2], rom[offset+3])
+			}
+			fmt.Fprintf(out, "%03X  %-12s %s\n", addr, raw, text)
+			offset += size
+			continue
+		}
+
+		// Data runs up to 4 bytes per line, split at code and labels
+		end := offset + 1
+		for end < len(rom) && end-offset < 4 && !f.covered[end] {
+			if _, ok := f.labels[entryPoint+end]; ok {
+				break
+			}
+			end++
+		}
+
+		values := make([]string, 0, end-offset)
+		for _, b := range rom[offset:end] {
+			values = append(values, fmt.Sprintf("0x%02X", b))
+		}
+		fmt.Fprintf(out, "%03X  %-12s db %s\n", addr, fmt.Sprintf("% X", rom[offset:end]), strings.Join(values, ", "))
+		offset = end
+	}
+
+	return out.Flush()
+}
@@ -0,0 +1,144 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Sentinel errors for each kind of runtime fault, for use with errors.Is.
+var (
+	ErrStackOverflow     = errors.New("stack overflow")
+	ErrStackUnderflow    = errors.New("stack underflow")
+	ErrMemoryOutOfBounds = errors.New("memory access out of bounds")
+	ErrIllegalOpcode     = errors.New("illegal opcode")
+)
+
+// Registers is a snapshot of the CPU visible machine state.
+type Registers struct {
+	V            [16]uint8
+	I            uint16
+	PC           uint16
+	StackPointer uint8
+	Stack        [16]uint16
+	DelayTimer   uint8
+	SoundTimer   uint8
+}
+
+// Fault is returned when the running program does something the machine
+// cannot execute. The emulator stops in the FAULTED state until Reset.
+type Fault struct {
+	Err       error     // One of the Err* sentinels
+	PC        uint16    // Address of the faulting instruction
+	Opcode    uint16    // Faulting instruction
+	Address   int       // Offending address for ErrMemoryOutOfBounds
+	Registers Registers // Machine state when the fault was raised
+}
+
+func (f *Fault) Error() string {
+	if errors.Is(f.Err, ErrMemoryOutOfBounds) {
+		return fmt.Sprintf("%v: 0x%04X at PC 0x%03X (opcode 0x%04X)", f.Err, f.Address, f.PC, f.Opcode)
+	}
+	return fmt.Sprintf("%v at PC 0x%03X (opcode 0x%04X)", f.Err, f.PC, f.Opcode)
+}
+
+func (f *Fault) Unwrap() error {
+	return f.Err
+}
+
+func (chip8 *CHIP8) Registers() Registers {
+	return Registers{
+		V:            chip8.V,
+		I:            chip8.I,
+		PC:           chip8.PC,
+		StackPointer: chip8.stackPointer,
+		Stack:        chip8.stack,
+		DelayTimer:   chip8.delayTimer,
+		SoundTimer:   chip8.soundTimer,
+	}
+}
+
+// SetRegisters overwrites the CPU visible state, for debuggers. The stack
+// pointer is clamped to the platform's stack depth.
+func (chip8 *CHIP8) SetRegisters(regs Registers) {
+	chip8.V = regs.V
+	chip8.I = regs.I
+	chip8.PC = regs.PC
+	chip8.stackPointer = min(regs.StackPointer, uint8(chip8.stackDepth()))
+	chip8.stack = regs.Stack
+	chip8.delayTimer = regs.DelayTimer
+	chip8.soundTimer = regs.SoundTimer
+}
+
+// Fault returns the fault that stopped the machine, or nil.
+func (chip8 *CHIP8) Fault() *Fault {
+	return chip8.fault
+}
+
+// raise records a fault for the instruction currently executing, rewinds PC
+// to it and moves the emulator to the FAULTED state.
+func (chip8 *CHIP8) raise(err error, address int) error {
+	chip8.PC = chip8.instPC
+	chip8.fault = &Fault{
+		Err:       err,
+		PC:        chip8.instPC,
+		Opcode:    chip8.inst.opcode,
+		Address:   address,
+		Registers: chip8.Registers(),
+	}
+	chip8.state = FAULTED
+
+	return chip8.fault
+}
+
+// memorySize is the addressable RAM for the active platform.
+func (chip8 *CHIP8) memorySize() int {
+	return chip8.extension.memorySize()
+}
+
+// stackDepth is the number of nested subroutine calls the platform allows.
+func (chip8 *CHIP8) stackDepth() int {
+	return chip8.extension.stackDepth()
+}
+
+// memorySize is the addressable RAM on platform e.
+func (e Extension) memorySize() int {
+	if e == XOCHIP {
+		return xochipMemorySize
+	}
+	return chip8MemorySize
+}
+
+// stackDepth is the number of nested subroutine calls platform e allows.
+func (e Extension) stackDepth() int {
+	if e == CHIP_8 {
+		return 12 // COSMAC VIP reserves room for 12 return addresses
+	}
+	return len(CHIP8{}.stack)
+}
+
+// read returns the byte at addr, faulting when it is outside RAM.
+func (chip8 *CHIP8) read(addr int) (uint8, error) {
+	if addr < 0 || addr >= chip8.memorySize() {
+		return 0, chip8.raise(ErrMemoryOutOfBounds, addr)
+	}
+	chip8.watchMemory(addr, chip8.ram[addr], false)
+	return chip8.ram[addr], nil
+}
+
+// fetch reads an instruction byte like read, but is invisible to watchpoints.
+func (chip8 *CHIP8) fetch(addr int) (uint8, error) {
+	if addr < 0 || addr >= chip8.memorySize() {
+		return 0, chip8.raise(ErrMemoryOutOfBounds, addr)
+	}
+	return chip8.ram[addr], nil
+}
+
+// write stores value at addr, faulting when it is outside RAM.
+func (chip8 *CHIP8) write(addr int, value uint8) error {
+	if addr < 0 || addr >= chip8.memorySize() {
+		return chip8.raise(ErrMemoryOutOfBounds, addr)
+	}
+	chip8.ram[addr] = value
+	chip8.watchMemory(addr, value, true)
+	return nil
+}
@@ -0,0 +1,166 @@
+package core
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fuzzSteps bounds each fuzz run, so looping ROMs still finish quickly.
+const fuzzSteps = 2000
+
+// fuzzQuirks turns each bit of mask into one quirk.
+func fuzzQuirks(mask uint8) Quirks {
+	return Quirks{
+		VFReset:            mask&0x01 != 0,
+		Shifting:           mask&0x02 != 0,
+		MemoryIncrement:    mask&0x04 != 0,
+		MemoryIncrementByX: mask&0x08 != 0,
+		Jumping:            mask&0x10 != 0,
+		Clipping:           mask&0x20 != 0,
+		DisplayWait:        mask&0x40 != 0,
+		RowCollisions:      mask&0x80 != 0,
+	}
+}
+
+// addFuzzROMs seeds the corpus with the test suite ROMs on every platform.
+func addFuzzROMs(f *testing.F, add func(rom []byte, extension Extension)) {
+	paths, _ := filepath.Glob("../roms/tests/*.ch8")
+	for _, path := range paths {
+		rom, err := os.ReadFile(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+		for _, extension := range []Extension{CHIP_8, SUPERCHIP, XOCHIP} {
+			add(rom, extension)
+		}
+	}
+}
+
+// fuzzRun executes up to fuzzSteps instructions, pressing keys from keys
+// and ticking the timers as it goes, and checks the machine invariants
+// after each one. It stops at the first fault, since the machine stays
+// FAULTED until Reset.
+func fuzzRun(t *testing.T, c *CHIP8, keys uint16) {
+	t.Helper()
+
+	for step := range fuzzSteps {
+		// Hold each key for a while so FX0A sees presses and releases
+		if step%16 == 0 {
+			c.SetKeypadMask(keys >> (step / 16 % 16))
+			c.UpdateTimers()
+		}
+
+		pc := c.PC
+		err := c.ExecuteInstruction()
+		if broken := checkInvariants(c, pc, err); broken != nil {
+			t.Fatalf("step %d: %v", step, broken)
+		}
+
+		if err != nil || c.State() != RUNNING {
+			return
+		}
+	}
+}
+
+// checkInvariants verifies the machine after executing the instruction at
+// pc: an instruction only runs when it is wholly inside RAM, a fault rewinds
+// PC to the faulting instruction and only reports addresses outside RAM, and
+// the stack pointer stays within the platform's stack.
+func checkInvariants(c *CHIP8, pc uint16, err error) error {
+	if int(c.stackPointer) > c.stackDepth() {
+		return fmt.Errorf("stack pointer %d past stack depth %d", c.stackPointer, c.stackDepth())
+	}
+
+	if err == nil {
+		if int(pc)+1 >= c.memorySize() {
+			return fmt.Errorf("executed instruction at 0x%04X past the end of RAM (0x%X)", pc, c.memorySize())
+		}
+		return nil
+	}
+
+	var fault *Fault
+	if !errors.As(err, &fault) {
+		return fmt.Errorf("err = %v, want *Fault", err)
+	}
+	if c.State() != FAULTED {
+		return fmt.Errorf("state = %v after fault %v, want FAULTED", c.State(), err)
+	}
+	if c.PC != pc || fault.PC != pc {
+		return fmt.Errorf("PC = 0x%04X, fault PC = 0x%04X, want 0x%04X", c.PC, fault.PC, pc)
+	}
+	if errors.Is(err, ErrMemoryOutOfBounds) && fault.Address >= 0 && fault.Address < c.memorySize() {
+		return fmt.Errorf("out of bounds fault for address 0x%04X inside RAM", fault.Address)
+	}
+
+	return nil
+}
+
+// FuzzROM runs arbitrary ROM images on a freshly reset machine.
+func FuzzROM(f *testing.F) {
+	addFuzzROMs(f, func(rom []byte, extension Extension) {
+		f.Add(rom, uint8(extension), uint8(0), uint16(0))
+	})
+	// Deep recursion, and FX33, FX55 and DXYN at the end of RAM
+	f.Add([]byte{0x22, 0x00}, uint8(CHIP_8), uint8(0), uint16(0))
+	f.Add([]byte{0xAF, 0xFF, 0xF0, 0x33}, uint8(CHIP_8), uint8(0), uint16(0))
+	f.Add([]byte{0xAF, 0xF0, 0xFF, 0x55}, uint8(SUPERCHIP), uint8(0x04), uint16(0))
+	f.Add([]byte{0xAF, 0xFF, 0xD0, 0x10}, uint8(SUPERCHIP), uint8(0x20), uint16(0))
+
+	f.Fuzz(func(t *testing.T, rom []byte, extension uint8, quirks uint8, keys uint16) {
+		var c CHIP8
+		c.InitData("fuzz", rom, Extension(extension%3), fuzzQuirks(quirks))
+		fuzzRun(t, &c, keys)
+	})
+}
+
+// fuzzRegisterSize is the encoded size of a Registers: V, I, PC, the stack
+// pointer, the stack and both timers.
+const fuzzRegisterSize = 16 + 2 + 2 + 1 + 16*2 + 2
+
+// fuzzRegisters decodes an arbitrary register state from data, zero padded.
+func fuzzRegisters(data []byte) Registers {
+	var buf [fuzzRegisterSize]byte
+	copy(buf[:], data)
+
+	var regs Registers
+	copy(regs.V[:], buf[:16])
+	regs.I = binary.BigEndian.Uint16(buf[16:])
+	regs.PC = binary.BigEndian.Uint16(buf[18:])
+	regs.StackPointer = buf[20]
+	for i := range regs.Stack {
+		regs.Stack[i] = binary.BigEndian.Uint16(buf[21+2*i:])
+	}
+	regs.DelayTimer = buf[53]
+	regs.SoundTimer = buf[54]
+
+	return regs
+}
+
+// FuzzState runs arbitrary ROM images from an arbitrary register state, as a
+// debugger or savestate might leave it.
+func FuzzState(f *testing.F) {
+	entry := make([]byte, fuzzRegisterSize)
+	binary.BigEndian.PutUint16(entry[18:], EntryPoint)
+
+	addFuzzROMs(f, func(rom []byte, extension Extension) {
+		f.Add(rom, entry, uint8(extension), uint8(0), uint16(0))
+	})
+	// I and PC at the end of RAM, and a full stack
+	endOfRAM := make([]byte, fuzzRegisterSize)
+	binary.BigEndian.PutUint16(endOfRAM[16:], 0xFFFF)
+	binary.BigEndian.PutUint16(endOfRAM[18:], 0x0FFE)
+	endOfRAM[20] = 0xFF
+	f.Add([]byte{0xF0, 0x33}, endOfRAM, uint8(CHIP_8), uint8(0), uint16(0))
+	f.Add([]byte{0x00, 0xEE}, endOfRAM, uint8(XOCHIP), uint8(0), uint16(0))
+
+	f.Fuzz(func(t *testing.T, rom []byte, state []byte, extension uint8, quirks uint8, keys uint16) {
+		var c CHIP8
+		c.InitData("fuzz", rom, Extension(extension%3), fuzzQuirks(quirks))
+		c.SetRegisters(fuzzRegisters(state))
+		fuzzRun(t, &c, keys)
+	})
+}
@@ -0,0 +1,96 @@
+package core
+
+// Framebuffer exposes the machine's display to a frontend. Pixel returns the
+// lit bitplanes at x, y: 0 is background, 1 and 2 are the XO-CHIP planes and
+// 3 is both. Plain CHIP8 and SCHIP only ever use plane 1.
+type Framebuffer interface {
+	Width() int
+	Height() int
+	Pixel(x, y int) uint8
+}
+
+// Keypad lets a frontend feed host input into the hex keypad.
+type Keypad interface {
+	SetKey(key uint8, pressed bool)
+}
+
+// Buzzer reports whether the sound timer is currently running and, for
+// XO-CHIP, which 1-bit sample pattern to play and at what rate in Hz. ok is
+// false when no pattern has been loaded and the default tone should be used.
+type Buzzer interface {
+	Beeping() bool
+	AudioPattern() (pattern [16]uint8, rate float64, ok bool)
+}
+
+// Width returns the current horizontal resolution.
+func (chip8 *CHIP8) Width() int {
+	if chip8.hires {
+		return HiresWidth
+	}
+	return DisplayWidth
+}
+
+// Height returns the current vertical resolution.
+func (chip8 *CHIP8) Height() int {
+	if chip8.hires {
+		return HiresHeight
+	}
+	return DisplayHeight
+}
+
+func (chip8 *CHIP8) Pixel(x, y int) uint8 {
+	return chip8.display[y*chip8.Width()+x]
+}
+
+func (chip8 *CHIP8) SetKey(key uint8, pressed bool) {
+	chip8.keypad[key&0xF] = pressed
+}
+
+// KeypadMask returns the keypad as a bitmask, bit N set when key N is held.
+func (chip8 *CHIP8) KeypadMask() uint16 {
+	var mask uint16
+	for key, pressed := range chip8.keypad {
+		if pressed {
+			mask |= 1 << key
+		}
+	}
+	return mask
+}
+
+// SetKeypadMask sets every key from a bitmask made by KeypadMask.
+func (chip8 *CHIP8) SetKeypadMask(mask uint16) {
+	for key := range chip8.keypad {
+		chip8.keypad[key] = mask&(1<<key) != 0
+	}
+}
+
+func (chip8 *CHIP8) Beeping() bool {
+	return chip8.beeping
+}
+
+// setPixel XORs spriteBit onto plane of the display and reports whether a lit pixel was turned off.
+func (chip8 *CHIP8) setPixel(x, y int, plane uint8, spriteBit bool) bool {
+	width, height := chip8.Width(), chip8.Height()
+
+	// Wrap around screen edges
+	x %= width
+	y %= height
+
+	pixelIndex := y*width + x
+
+	if !spriteBit {
+		return false
+	}
+
+	collision := chip8.display[pixelIndex]&plane != 0
+	chip8.display[pixelIndex] ^= plane
+
+	return collision
+}
+
+// clearDisplay blanks the currently selected planes.
+func (chip8 *CHIP8) clearDisplay() {
+	for i := range chip8.display {
+		chip8.display[i] &^= chip8.planes
+	}
+}
@@ -0,0 +1,177 @@
+package core
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Movie files start with movieMagic and a version number, followed by a
+// fixed size movieHeader and one little endian uint16 keypad mask per frame.
+const (
+	movieMagic   = "CH8M"
+	movieVersion = 2
+)
+
+var ErrMovieFormat = errors.New("not a CHIP8 movie")
+
+// Movie is a recording of the keypad state for every frame since power on,
+// plus everything else needed to replay the run bit for bit.
+type Movie struct {
+	RomHash       [20]uint8
+	Seed          uint64
+	VIPRandom     bool // CXNN used a VIPRandom rather than the default source
+	Extension     Extension
+	Quirks        Quirks
+	VIPTiming     bool   // Frames ran with RunVIPFrame
+	InstsPerFrame uint32 // Frames ran with RunFrame(InstsPerFrame)
+	Frames        []uint16
+}
+
+type movieHeader struct {
+	RomHash       [20]uint8
+	Seed          uint64
+	VIPRandom     bool
+	Extension     uint8
+	Quirks        Quirks
+	VIPTiming     bool
+	InstsPerFrame uint32
+	FrameCount    uint32
+}
+
+// NewMovie starts a recording for the machine as it is now. The machine
+// should be freshly Reset so replays start from the same state.
+func NewMovie(chip8 *CHIP8, vipTiming bool, instsPerFrame uint32) *Movie {
+	_, vipRandom := chip8.random.(*VIPRandom)
+
+	return &Movie{
+		RomHash:       chip8.romHash,
+		Seed:          chip8.seed,
+		VIPRandom:     vipRandom,
+		Extension:     chip8.extension,
+		Quirks:        chip8.quirks,
+		VIPTiming:     vipTiming,
+		InstsPerFrame: instsPerFrame,
+	}
+}
+
+// Record appends the current keypad state as the input for the next frame.
+func (m *Movie) Record(chip8 *CHIP8) {
+	m.Frames = append(m.Frames, chip8.KeypadMask())
+}
+
+// Apply feeds the input recorded for frame into the keypad. It returns false
+// once the movie has run out of frames.
+func (m *Movie) Apply(chip8 *CHIP8, frame int) bool {
+	if frame < 0 || frame >= len(m.Frames) {
+		return false
+	}
+
+	chip8.SetKeypadMask(m.Frames[frame])
+
+	return true
+}
+
+// Save writes the movie to the file at path.
+func (m *Movie) Save(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create movie: %w", err)
+	}
+
+	w := bufio.NewWriter(file)
+	if err := m.write(w); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write movie: %w", err)
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write movie: %w", err)
+	}
+
+	return file.Close()
+}
+
+func (m *Movie) write(w io.Writer) error {
+	header := movieHeader{
+		RomHash:       m.RomHash,
+		Seed:          m.Seed,
+		VIPRandom:     m.VIPRandom,
+		Extension:     uint8(m.Extension),
+		Quirks:        m.Quirks,
+		VIPTiming:     m.VIPTiming,
+		InstsPerFrame: m.InstsPerFrame,
+		FrameCount:    uint32(len(m.Frames)),
+	}
+
+	if _, err := io.WriteString(w, movieMagic); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, uint16(movieVersion)); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, &header); err != nil {
+		return err
+	}
+
+	return binary.Write(w, binary.LittleEndian, m.Frames)
+}
+
+// LoadMovie reads a movie written by Movie.Save.
+func LoadMovie(path string) (*Movie, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open movie: %w", err)
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+
+	magic := make([]uint8, len(movieMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != movieMagic {
+		return nil, ErrMovieFormat
+	}
+
+	var version uint16
+	if err := binary.Read(r, binary.LittleEndian, &version); err != nil {
+		return nil, ErrMovieFormat
+	}
+	if version != movieVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrMovieFormat, version)
+	}
+
+	var header movieHeader
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMovieFormat, err)
+	}
+
+	// The frames fill the rest of the file, so a corrupt count can't make us
+	// allocate more than the file holds
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read movie: %w", err)
+	}
+	remaining := info.Size() - int64(len(movieMagic)+2+binary.Size(header))
+	if int64(header.FrameCount)*2 > remaining {
+		return nil, fmt.Errorf("%w: %d frames in %d bytes", ErrMovieFormat, header.FrameCount, remaining)
+	}
+
+	frames := make([]uint16, header.FrameCount)
+	if err := binary.Read(r, binary.LittleEndian, frames); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMovieFormat, err)
+	}
+
+	return &Movie{
+		RomHash:       header.RomHash,
+		Seed:          header.Seed,
+		VIPRandom:     header.VIPRandom,
+		Extension:     Extension(header.Extension),
+		Quirks:        header.Quirks,
+		VIPTiming:     header.VIPTiming,
+		InstsPerFrame: header.InstsPerFrame,
+		Frames:        frames,
+	}, nil
+}
@@ -0,0 +1,46 @@
+package core
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadMovieFrameCount(t *testing.T) {
+	c := newTestMachine(CHIP_8, vip, []uint8{0x12, 0x00})
+	movie := NewMovie(c, false, 8)
+	for _, mask := range []uint16{0x0001, 0x0000, 0x8000} {
+		c.SetKeypadMask(mask)
+		movie.Record(c)
+	}
+
+	path := filepath.Join(t.TempDir(), "test.movie")
+	if err := movie.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadMovie(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "frames", len(loaded.Frames), 3)
+	expect(t, "last frame", loaded.Frames[2], 0x8000)
+
+	// FrameCount is the last field of the header
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	countAt := len(movieMagic) + 2 + binary.Size(movieHeader{}) - 4
+	for _, count := range []uint32{4, 0xFFFFFFFF} {
+		binary.LittleEndian.PutUint32(data[countAt:], count)
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadMovie(path); !errors.Is(err, ErrMovieFormat) {
+			t.Errorf("frame count %d: got error %v, want %v", count, err, ErrMovieFormat)
+		}
+	}
+}
@@ -0,0 +1,845 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// octoToken is one whitespace separated word of Octo source.
+type octoToken struct {
+	text   string
+	line   int
+	column int
+}
+
+// octoMacro is a :macro definition, expanded by substituting its arguments
+// into the body tokens.
+type octoMacro struct {
+	args []string
+	body []octoToken
+}
+
+// octoFixup patches a label address into code once the label is defined.
+type octoFixup struct {
+	addr  int
+	label octoToken
+	long  bool // 16 bit XO-CHIP address instead of the low 12 bits of an opcode
+}
+
+// octoBranch is an open if ... begin or while, waiting for its jump target.
+type octoBranch struct {
+	jump int // Address of the jump to patch
+}
+
+// octoLoop is an open loop, with the jumps out of it made by while.
+type octoLoop struct {
+	start  int
+	breaks []int
+}
+
+type octoCompiler struct {
+	tokens     []octoToken
+	pos        int
+	rom        [xochipMemorySize]uint8
+	used       [xochipMemorySize]bool
+	here       int
+	end        int // One past the highest address written
+	labels     map[string]int
+	consts     map[string]int
+	aliases    map[string]uint8
+	macros     map[string]*octoMacro
+	fixups     []octoFixup
+	branches   []octoBranch
+	loops      []octoLoop
+	expansions int
+}
+
+// octoMaxExpansions bounds macro expansion so recursive macros fail instead
+// of hanging.
+const octoMaxExpansions = 100000
+
+// CompileOcto compiles Octo source into a ROM image to be loaded at
+// EntryPoint. It supports labels, :alias, :const, :macro, :org, :next, :byte,
+// :call, loop/while/again, if ... then and if ... begin/else/end, and the
+// CHIP8, SCHIP and XO-CHIP statements. Execution starts at the label main,
+// reached by a jump at EntryPoint. Errors are *AsmError with the position of
+// the offending token.
+func CompileOcto(source io.Reader) ([]uint8, error) {
+	text, err := io.ReadAll(source)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &octoCompiler{
+		tokens:  tokenizeOcto(string(text)),
+		here:    EntryPoint,
+		labels:  map[string]int{},
+		consts:  map[string]int{},
+		aliases: map[string]uint8{},
+		macros:  map[string]*octoMacro{},
+	}
+
+	// Reserve the jump to main
+	main := octoToken{text: "main", line: 1, column: 1}
+	if err := c.emitAddr(0x1000, main); err != nil {
+		return nil, err
+	}
+
+	for c.pos < len(c.tokens) {
+		if err := c.statement(); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(c.branches) > 0 || len(c.loops) > 0 {
+		last := c.tokens[len(c.tokens)-1]
+		return nil, c.errorf(last, "missing end or again at end of file")
+	}
+	if _, ok := c.labels["main"]; !ok {
+		return nil, c.errorf(main, "missing : main label")
+	}
+
+	for _, fixup := range c.fixups {
+		addr, ok := c.labels[fixup.label.text]
+		if !ok {
+			return nil, c.errorf(fixup.label, "undefined label %q", fixup.label.text)
+		}
+		if fixup.long {
+			c.rom[fixup.addr], c.rom[fixup.addr+1] = uint8(addr>>8), uint8(addr)
+			continue
+		}
+		if addr > 0xFFF {
+			return nil, c.errorf(fixup.label, "label %s at 0x%04X is out of 12 bit range", fixup.label.text, addr)
+		}
+		c.rom[fixup.addr] |= uint8(addr >> 8)
+		c.rom[fixup.addr+1] = uint8(addr)
+	}
+
+	return c.rom[EntryPoint:c.end], nil
+}
+
+// tokenizeOcto splits source into words, dropping # comments.
+func tokenizeOcto(source string) []octoToken {
+	var tokens []octoToken
+	for lineNo, line := range strings.Split(source, "\n") {
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+
+		start := -1
+		for i, r := range line + " " {
+			switch {
+			case unicode.IsSpace(r) && start >= 0:
+				tokens = append(tokens, octoToken{line[start:i], lineNo + 1, start + 1})
+				start = -1
+			case !unicode.IsSpace(r) && start < 0:
+				start = i
+			}
+		}
+	}
+	return tokens
+}
+
+func (c *octoCompiler) errorf(tok octoToken, format string, args ...any) error {
+	return &AsmError{Line: tok.line, Column: tok.column, Msg: fmt.Sprintf(format, args...)}
+}
+
+// next consumes a token, failing at the end of the source.
+func (c *octoCompiler) next() (octoToken, error) {
+	if c.pos >= len(c.tokens) {
+		last := octoToken{line: 1, column: 1}
+		if len(c.tokens) > 0 {
+			last = c.tokens[len(c.tokens)-1]
+		}
+		return last, c.errorf(last, "unexpected end of file")
+	}
+	tok := c.tokens[c.pos]
+	c.pos++
+	return tok, nil
+}
+
+func (c *octoCompiler) peek() string {
+	if c.pos >= len(c.tokens) {
+		return ""
+	}
+	return c.tokens[c.pos].text
+}
+
+// expect consumes a token that must be word.
+func (c *octoCompiler) expect(word string) error {
+	tok, err := c.next()
+	if err != nil {
+		return err
+	}
+	if tok.text != word {
+		return c.errorf(tok, "expected %q, got %q", word, tok.text)
+	}
+	return nil
+}
+
+func (c *octoCompiler) emitByte(tok octoToken, b uint8) error {
+	if c.here < EntryPoint || c.here >= len(c.rom) {
+		return c.errorf(tok, "address 0x%04X is outside program memory", c.here)
+	}
+	if c.used[c.here] {
+		return c.errorf(tok, "address 0x%04X is already in use", c.here)
+	}
+	c.rom[c.here] = b
+	c.used[c.here] = true
+	c.here++
+	c.end = max(c.end, c.here)
+	return nil
+}
+
+func (c *octoCompiler) emit(tok octoToken, opcode uint16) error {
+	if err := c.emitByte(tok, uint8(opcode>>8)); err != nil {
+		return err
+	}
+	return c.emitByte(tok, uint8(opcode))
+}
+
+// emitAddr emits base with the address named by tok in its low 12 bits.
+func (c *octoCompiler) emitAddr(base uint16, tok octoToken) error {
+	if addr, ok := c.constant(tok); ok {
+		if addr < 0 || addr > 0xFFF {
+			return c.errorf(tok, "address 0x%X is out of 12 bit range", addr)
+		}
+		return c.emit(tok, base|uint16(addr))
+	}
+	if !isIdentifier(tok.text) {
+		return c.errorf(tok, "expected an address, got %q", tok.text)
+	}
+
+	c.fixups = append(c.fixups, octoFixup{addr: c.here, label: tok})
+	return c.emit(tok, base)
+}
+
+// constant evaluates a number or :const name.
+func (c *octoCompiler) constant(tok octoToken) (int, bool) {
+	if v, ok := c.consts[tok.text]; ok {
+		return v, true
+	}
+	v, err := strconv.ParseInt(tok.text, 0, 32)
+	return int(v), err == nil
+}
+
+// value consumes a constant within [lo, hi].
+func (c *octoCompiler) value(lo, hi int) (int, error) {
+	tok, err := c.next()
+	if err != nil {
+		return 0, err
+	}
+	v, ok := c.constant(tok)
+	if !ok {
+		return 0, c.errorf(tok, "expected a number, got %q", tok.text)
+	}
+	if v < lo || v > hi {
+		return 0, c.errorf(tok, "value %d out of range %d to %d", v, lo, hi)
+	}
+	return v, nil
+}
+
+// byteValue consumes a constant that fits a byte, wrapping negatives.
+func (c *octoCompiler) byteValue() (uint16, error) {
+	v, err := c.value(-128, 0xFF)
+	return uint16(v) & 0xFF, err
+}
+
+// register resolves v0-vf or an :alias.
+func (c *octoCompiler) register(text string) (uint8, bool) {
+	if r, ok := c.aliases[text]; ok {
+		return r, true
+	}
+	return parseRegister(text)
+}
+
+// reg consumes a register.
+func (c *octoCompiler) reg() (uint16, error) {
+	tok, err := c.next()
+	if err != nil {
+		return 0, err
+	}
+	r, ok := c.register(tok.text)
+	if !ok {
+		return 0, c.errorf(tok, "expected a register, got %q", tok.text)
+	}
+	return uint16(r), nil
+}
+
+// name consumes a new label, constant, alias or macro name.
+func (c *octoCompiler) name() (octoToken, error) {
+	tok, err := c.next()
+	if err != nil {
+		return tok, err
+	}
+	if !isIdentifier(tok.text) {
+		return tok, c.errorf(tok, "invalid name %q", tok.text)
+	}
+	return tok, nil
+}
+
+func (c *octoCompiler) defineLabel(tok octoToken, addr int) error {
+	if _, ok := c.labels[tok.text]; ok {
+		return c.errorf(tok, "label %s is already defined", tok.text)
+	}
+	c.labels[tok.text] = addr
+	return nil
+}
+
+// patch points the jump at addr to target. tok is the statement that ends
+// the block, where a target past 12 bits is reported.
+func (c *octoCompiler) patch(tok octoToken, addr, target int) error {
+	if target > 0xFFF {
+		return c.errorf(tok, "jump target 0x%04X is out of 12 bit range", target)
+	}
+	c.rom[addr] = 0x10 | uint8(target>>8)
+	c.rom[addr+1] = uint8(target)
+	return nil
+}
+
+func (c *octoCompiler) statement() error {
+	tok, err := c.next()
+	if err != nil {
+		return err
+	}
+
+	switch tok.text {
+	case ":":
+		label, err := c.name()
+		if err != nil {
+			return err
+		}
+		return c.defineLabel(label, c.here)
+	case ":next":
+		// Labels the operand byte of the following instruction, for self-modifying code
+		label, err := c.name()
+		if err != nil {
+			return err
+		}
+		return c.defineLabel(label, c.here+1)
+	case ":alias":
+		alias, err := c.name()
+		if err != nil {
+			return err
+		}
+		r, err := c.reg()
+		if err != nil {
+			return err
+		}
+		c.aliases[alias.text] = uint8(r)
+		return nil
+	case ":const":
+		name, err := c.name()
+		if err != nil {
+			return err
+		}
+		v, err := c.value(-0x8000, 0xFFFF)
+		if err != nil {
+			return err
+		}
+		c.consts[name.text] = v
+		return nil
+	case ":macro":
+		return c.defineMacro()
+	case ":org":
+		addr, err := c.value(EntryPoint, len(c.rom)-1)
+		if err != nil {
+			return err
+		}
+		c.here = addr
+		return nil
+	case ":byte":
+		b, err := c.byteValue()
+		if err != nil {
+			return err
+		}
+		return c.emitByte(tok, uint8(b))
+	case ":call":
+		target, err := c.next()
+		if err != nil {
+			return err
+		}
+		return c.emitAddr(0x2000, target)
+
+	case "clear":
+		return c.emit(tok, 0x00E0)
+	case "return", ";":
+		return c.emit(tok, 0x00EE)
+	case "hires":
+		return c.emit(tok, 0x00FF)
+	case "lores":
+		return c.emit(tok, 0x00FE)
+	case "exit":
+		return c.emit(tok, 0x00FD)
+	case "scroll-left":
+		return c.emit(tok, 0x00FC)
+	case "scroll-right":
+		return c.emit(tok, 0x00FB)
+	case "scroll-down", "scroll-up":
+		n, err := c.value(0, 0xF)
+		if err != nil {
+			return err
+		}
+		if tok.text == "scroll-down" {
+			return c.emit(tok, 0x00C0|uint16(n))
+		}
+		return c.emit(tok, 0x00D0|uint16(n))
+	case "audio":
+		return c.emit(tok, 0xF002)
+	case "plane":
+		n, err := c.value(0, 3)
+		if err != nil {
+			return err
+		}
+		return c.emit(tok, 0xF001|uint16(n)<<8)
+	case "jump", "jump0", "native":
+		target, err := c.next()
+		if err != nil {
+			return err
+		}
+		bases := map[string]uint16{"jump": 0x1000, "jump0": 0xB000, "native": 0x0000}
+		return c.emitAddr(bases[tok.text], target)
+	case "sprite":
+		x, err := c.reg()
+		if err != nil {
+			return err
+		}
+		y, err := c.reg()
+		if err != nil {
+			return err
+		}
+		n, err := c.value(0, 0xF)
+		if err != nil {
+			return err
+		}
+		return c.emit(tok, 0xD000|x<<8|y<<4|uint16(n))
+	case "bcd", "saveflags", "loadflags":
+		x, err := c.reg()
+		if err != nil {
+			return err
+		}
+		codes := map[string]uint16{"bcd": 0xF033, "saveflags": 0xF075, "loadflags": 0xF085}
+		return c.emit(tok, codes[tok.text]|x<<8)
+	case "save", "load":
+		x, err := c.reg()
+		if err != nil {
+			return err
+		}
+		// save vx - vy is the XO-CHIP register range form
+		if c.peek() == "-" {
+			c.pos++
+			y, err := c.reg()
+			if err != nil {
+				return err
+			}
+			if tok.text == "save" {
+				return c.emit(tok, 0x5002|x<<8|y<<4)
+			}
+			return c.emit(tok, 0x5003|x<<8|y<<4)
+		}
+		if tok.text == "save" {
+			return c.emit(tok, 0xF055|x<<8)
+		}
+		return c.emit(tok, 0xF065|x<<8)
+	case "delay", "buzzer", "pitch":
+		if err := c.expect(":="); err != nil {
+			return err
+		}
+		x, err := c.reg()
+		if err != nil {
+			return err
+		}
+		codes := map[string]uint16{"delay": 0xF015, "buzzer": 0xF018, "pitch": 0xF03A}
+		return c.emit(tok, codes[tok.text]|x<<8)
+	case "i":
+		return c.index(tok)
+
+	case "if":
+		return c.ifStatement(tok)
+	case "else":
+		if len(c.branches) == 0 {
+			return c.errorf(tok, "else without if ... begin")
+		}
+		jump := c.here
+		if err := c.emit(tok, 0x1000); err != nil {
+			return err
+		}
+		top := &c.branches[len(c.branches)-1]
+		if err := c.patch(tok, top.jump, c.here); err != nil {
+			return err
+		}
+		top.jump = jump
+		return nil
+	case "end":
+		if len(c.branches) == 0 {
+			return c.errorf(tok, "end without if ... begin")
+		}
+		if err := c.patch(tok, c.branches[len(c.branches)-1].jump, c.here); err != nil {
+			return err
+		}
+		c.branches = c.branches[:len(c.branches)-1]
+		return nil
+	case "loop":
+		c.loops = append(c.loops, octoLoop{start: c.here})
+		return nil
+	case "while":
+		if len(c.loops) == 0 {
+			return c.errorf(tok, "while outside of a loop")
+		}
+		cond, err := c.condition()
+		if err != nil {
+			return err
+		}
+		if err := c.emitCondition(tok, cond, cond.skipTrue); err != nil {
+			return err
+		}
+		top := &c.loops[len(c.loops)-1]
+		top.breaks = append(top.breaks, c.here)
+		return c.emit(tok, 0x1000)
+	case "again":
+		if len(c.loops) == 0 {
+			return c.errorf(tok, "again without loop")
+		}
+		top := c.loops[len(c.loops)-1]
+		c.loops = c.loops[:len(c.loops)-1]
+		if top.start > 0xFFF {
+			return c.errorf(tok, "loop at 0x%04X is out of 12 bit range", top.start)
+		}
+		if err := c.emit(tok, 0x1000|uint16(top.start)); err != nil {
+			return err
+		}
+		for _, jump := range top.breaks {
+			if err := c.patch(tok, jump, c.here); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if x, ok := c.register(tok.text); ok {
+		return c.assignment(tok, uint16(x))
+	}
+
+	if macro, ok := c.macros[tok.text]; ok {
+		return c.expand(tok, macro)
+	}
+
+	// Bare numbers and constants are data bytes
+	if v, ok := c.constant(tok); ok {
+		if v < -128 || v > 0xFF {
+			return c.errorf(tok, "byte %d out of range", v)
+		}
+		return c.emitByte(tok, uint8(v))
+	}
+
+	// Anything else names a subroutine to call
+	if !isIdentifier(tok.text) || strings.HasPrefix(tok.text, ":") {
+		return c.errorf(tok, "unknown statement %q", tok.text)
+	}
+	return c.emitAddr(0x2000, tok)
+}
+
+// index compiles the statements starting with i.
+func (c *octoCompiler) index(tok octoToken) error {
+	op, err := c.next()
+	if err != nil {
+		return err
+	}
+
+	switch op.text {
+	case "+=":
+		x, err := c.reg()
+		if err != nil {
+			return err
+		}
+		return c.emit(tok, 0xF01E|x<<8)
+	case ":=":
+	default:
+		return c.errorf(op, "expected := or +=, got %q", op.text)
+	}
+
+	src, err := c.next()
+	if err != nil {
+		return err
+	}
+
+	switch src.text {
+	case "hex", "bighex":
+		x, err := c.reg()
+		if err != nil {
+			return err
+		}
+		if src.text == "hex" {
+			return c.emit(tok, 0xF029|x<<8)
+		}
+		return c.emit(tok, 0xF030|x<<8)
+	case "long":
+		target, err := c.next()
+		if err != nil {
+			return err
+		}
+		if err := c.emit(tok, 0xF000); err != nil {
+			return err
+		}
+		if addr, ok := c.constant(target); ok {
+			return c.emit(target, uint16(addr))
+		}
+		if !isIdentifier(target.text) {
+			return c.errorf(target, "expected an address, got %q", target.text)
+		}
+		c.fixups = append(c.fixups, octoFixup{addr: c.here, label: target, long: true})
+		return c.emit(target, 0)
+	}
+
+	return c.emitAddr(0xA000, src)
+}
+
+// assignment compiles vx followed by an operator.
+func (c *octoCompiler) assignment(tok octoToken, x uint16) error {
+	op, err := c.next()
+	if err != nil {
+		return err
+	}
+
+	aluOps := map[string]uint16{
+		"|=": 0x8001, "&=": 0x8002, "^=": 0x8003,
+		"=-": 0x8007, ">>=": 0x8006, "<<=": 0x800E,
+	}
+	if base, ok := aluOps[op.text]; ok {
+		y, err := c.reg()
+		if err != nil {
+			return err
+		}
+		return c.emit(tok, base|x<<8|y<<4)
+	}
+
+	src := c.peek()
+	y, srcIsReg := c.register(src)
+
+	switch op.text {
+	case ":=":
+		switch {
+		case srcIsReg:
+			c.pos++
+			return c.emit(tok, 0x8000|x<<8|uint16(y)<<4)
+		case src == "random":
+			c.pos++
+			nn, err := c.byteValue()
+			if err != nil {
+				return err
+			}
+			return c.emit(tok, 0xC000|x<<8|nn)
+		case src == "delay":
+			c.pos++
+			return c.emit(tok, 0xF007|x<<8)
+		case src == "key":
+			c.pos++
+			return c.emit(tok, 0xF00A|x<<8)
+		}
+		nn, err := c.byteValue()
+		if err != nil {
+			return err
+		}
+		return c.emit(tok, 0x6000|x<<8|nn)
+	case "+=", "-=":
+		if srcIsReg {
+			c.pos++
+			if op.text == "+=" {
+				return c.emit(tok, 0x8004|x<<8|uint16(y)<<4)
+			}
+			return c.emit(tok, 0x8005|x<<8|uint16(y)<<4)
+		}
+		nn, err := c.byteValue()
+		if err != nil {
+			return err
+		}
+		if op.text == "-=" {
+			nn = -nn & 0xFF
+		}
+		return c.emit(tok, 0x7000|x<<8|nn)
+	}
+
+	return c.errorf(op, "unknown operator %q", op.text)
+}
+
+// octoCondition is a compiled if or while test: the setup instructions and
+// the skips taken when the test is false or true.
+type octoCondition struct {
+	prelude   []uint16
+	skipFalse uint16
+	skipTrue  uint16
+}
+
+// condition parses "vx == n", "vx key" and the like.
+func (c *octoCompiler) condition() (octoCondition, error) {
+	x, err := c.reg()
+	if err != nil {
+		return octoCondition{}, err
+	}
+	op, err := c.next()
+	if err != nil {
+		return octoCondition{}, err
+	}
+
+	switch op.text {
+	case "key":
+		return octoCondition{skipFalse: 0xE0A1 | x<<8, skipTrue: 0xE09E | x<<8}, nil
+	case "-key":
+		return octoCondition{skipFalse: 0xE09E | x<<8, skipTrue: 0xE0A1 | x<<8}, nil
+	case "==", "!=", "<", ">", "<=", ">=":
+	default:
+		return octoCondition{}, c.errorf(op, "unknown comparison %q", op.text)
+	}
+
+	y, rhsIsReg := c.register(c.peek())
+	var nn uint16
+	if rhsIsReg {
+		c.pos++
+	} else if nn, err = c.byteValue(); err != nil {
+		return octoCondition{}, err
+	}
+	yy := uint16(y)
+
+	switch op.text {
+	case "==", "!=":
+		equal, notEqual := 0x3000|x<<8|nn, 0x4000|x<<8|nn
+		if rhsIsReg {
+			equal, notEqual = 0x5000|x<<8|yy<<4, 0x9000|x<<8|yy<<4
+		}
+		// A skip over the body happens when the test fails
+		if op.text == "==" {
+			return octoCondition{skipFalse: notEqual, skipTrue: equal}, nil
+		}
+		return octoCondition{skipFalse: equal, skipTrue: notEqual}, nil
+	}
+
+	// Ordered comparisons leave VF = 1 when the left side >= the right
+	// side, computed with a subtraction into VF.
+	var prelude []uint16
+	swap := op.text == ">" || op.text == "<="
+	switch {
+	case rhsIsReg && !swap:
+		prelude = []uint16{0x8F00 | x<<4, 0x8F05 | yy<<4} // vf := vx, vf -= vy
+	case rhsIsReg && swap:
+		prelude = []uint16{0x8F00 | yy<<4, 0x8F05 | x<<4} // vf := vy, vf -= vx
+	case !swap:
+		prelude = []uint16{0x6F00 | nn, 0x8F07 | x<<4} // vf := nn, vf =- vx
+	default:
+		prelude = []uint16{0x6F00 | nn, 0x8F05 | x<<4} // vf := nn, vf -= vx
+	}
+
+	// >= and <= hold when VF is 1, < and > when it is 0
+	flag := uint16(1)
+	if op.text == "<" || op.text == ">" {
+		flag = 0
+	}
+	return octoCondition{prelude: prelude, skipFalse: 0x4F00 | flag, skipTrue: 0x3F00 | flag}, nil
+}
+
+func (c *octoCompiler) emitCondition(tok octoToken, cond octoCondition, skip uint16) error {
+	for _, opcode := range cond.prelude {
+		if err := c.emit(tok, opcode); err != nil {
+			return err
+		}
+	}
+	return c.emit(tok, skip)
+}
+
+// ifStatement compiles "if cond then" and "if cond begin".
+func (c *octoCompiler) ifStatement(tok octoToken) error {
+	cond, err := c.condition()
+	if err != nil {
+		return err
+	}
+
+	word, err := c.next()
+	if err != nil {
+		return err
+	}
+
+	switch word.text {
+	case "then":
+		// The next statement is skipped when the test fails
+		return c.emitCondition(tok, cond, cond.skipFalse)
+	case "begin":
+		// Jump over the block unless the test passes
+		if err := c.emitCondition(tok, cond, cond.skipTrue); err != nil {
+			return err
+		}
+		c.branches = append(c.branches, octoBranch{jump: c.here})
+		return c.emit(tok, 0x1000)
+	}
+
+	return c.errorf(word, "expected then or begin, got %q", word.text)
+}
+
+// defineMacro parses ":macro name args... { body }".
+func (c *octoCompiler) defineMacro() error {
+	name, err := c.name()
+	if err != nil {
+		return err
+	}
+
+	macro := &octoMacro{}
+	for {
+		tok, err := c.next()
+		if err != nil {
+			return err
+		}
+		if tok.text == "{" {
+			break
+		}
+		macro.args = append(macro.args, tok.text)
+	}
+
+	for depth := 1; ; {
+		tok, err := c.next()
+		if err != nil {
+			return err
+		}
+		switch tok.text {
+		case "{":
+			depth++
+		case "}":
+			depth--
+		}
+		if depth == 0 {
+			break
+		}
+		macro.body = append(macro.body, tok)
+	}
+
+	c.macros[name.text] = macro
+	return nil
+}
+
+// expand replaces a macro invocation with its body.
+func (c *octoCompiler) expand(tok octoToken, macro *octoMacro) error {
+	c.expansions++
+	if c.expansions > octoMaxExpansions {
+		return c.errorf(tok, "too many macro expansions, is %s recursive?", tok.text)
+	}
+
+	args := map[string]string{}
+	for _, name := range macro.args {
+		arg, err := c.next()
+		if err != nil {
+			return err
+		}
+		args[name] = arg.text
+	}
+
+	body := make([]octoToken, len(macro.body))
+	for i, t := range macro.body {
+		if arg, ok := args[t.text]; ok {
+			t.text = arg
+		}
+		body[i] = t
+	}
+
+	c.tokens = append(c.tokens[:c.pos], append(body, c.tokens[c.pos:]...)...)
+	return nil
+}
@@ -0,0 +1,190 @@
+package core
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// octoTest compiles source, runs it until it settles in its halt loop and
+// hands the machine to check. Every program ends in ": halt jump halt".
+type octoTest struct {
+	name   string
+	source string
+	check  func(t *testing.T, c *CHIP8)
+}
+
+// octoSteps is enough instructions for every octoTest to reach halt.
+const octoSteps = 200
+
+var octoTests = []octoTest{
+	{
+		name: "assignments",
+		source: `
+			: main
+				v0 := 5
+				v1 := v0
+				v1 += 3
+				v2 := 10
+				v2 -= 4
+				v3 := 250
+				v3 += v0
+			: halt jump halt`,
+		check: func(t *testing.T, c *CHIP8) {
+			expectV(t, c, 0, 5)
+			expectV(t, c, 1, 8)
+			expectV(t, c, 2, 6)
+			expectV(t, c, 3, 255)
+			expectV(t, c, 0xF, 0)
+			expectPC(t, c, 0x210)
+		},
+	},
+	{
+		name: "if begin else end",
+		source: `
+			: main
+				v0 := 3
+				if v0 == 3 begin v1 := 1 else v1 := 2 end
+				if v0 != 3 begin v2 := 1 else v2 := 2 end
+				if v0 > 2 then v3 := 7
+				if v0 < 2 then v4 := 7
+			: halt jump halt`,
+		check: func(t *testing.T, c *CHIP8) {
+			expectV(t, c, 1, 1)
+			expectV(t, c, 2, 2)
+			expectV(t, c, 3, 7)
+			expectV(t, c, 4, 0)
+			expectPC(t, c, 0x228)
+		},
+	},
+	{
+		name: "nested if",
+		source: `
+			: main
+				v0 := 1
+				v1 := 2
+				if v0 == 1 begin
+					if v1 == 3 begin v2 := 1 else v2 := 2 end
+				end
+			: halt jump halt`,
+		check: func(t *testing.T, c *CHIP8) {
+			expectV(t, c, 2, 2)
+			expectPC(t, c, 0x214)
+		},
+	},
+	{
+		name: "loop while again",
+		source: `
+			: main
+				v0 := 0
+				v1 := 0
+				loop
+					v0 += 1
+					v1 += 2
+					while v0 != 5
+				again
+			: halt jump halt`,
+		check: func(t *testing.T, c *CHIP8) {
+			expectV(t, c, 0, 5)
+			expectV(t, c, 1, 10)
+			expectPC(t, c, 0x210)
+		},
+	},
+	{
+		name: "labels, :next and :const",
+		source: `
+			:const SPEED 7
+			: main
+				:next target
+				v1 := 42
+				i := target
+				load v0
+				v2 := SPEED
+				sub
+			: halt jump halt
+			: sub
+				v3 := v2
+				return`,
+		check: func(t *testing.T, c *CHIP8) {
+			expectV(t, c, 0, 42)
+			expectV(t, c, 1, 42)
+			expectV(t, c, 2, 7)
+			expectV(t, c, 3, 7)
+			expect(t, "stack pointer", c.stackPointer, 0)
+			expectPC(t, c, 0x20C)
+		},
+	},
+	{
+		name: "alias and macro",
+		source: `
+			:alias counter v5
+			:macro bump reg amount { reg += amount }
+			: main
+				counter := 1
+				bump counter 4
+				bump v6 2
+			: halt jump halt`,
+		check: func(t *testing.T, c *CHIP8) {
+			expectV(t, c, 5, 5)
+			expectV(t, c, 6, 2)
+			expectPC(t, c, 0x208)
+		},
+	},
+}
+
+func TestCompileOcto(t *testing.T) {
+	for _, test := range octoTests {
+		t.Run(test.name, func(t *testing.T) {
+			rom, err := CompileOcto(strings.NewReader(test.source))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			c := newTestMachine(CHIP_8, vip, rom)
+			for range octoSteps {
+				if err := c.ExecuteInstruction(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			test.check(t, c)
+		})
+	}
+}
+
+func TestCompileOctoErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		err    string
+	}{
+		{"unknown statement", ": main\n  v0 := 1 @@", `2:11: unknown statement "@@"`},
+		{"unknown operator", ": main v0 ** 1", `1:11: unknown operator "**"`},
+		{"undefined label", ": main\n  nowhere", `2:3: undefined label "nowhere"`},
+		{"unterminated begin", ": main if v0 == 1 begin v1 := 2", "1:31: missing end or again at end of file"},
+		{"unterminated loop", ": main loop v0 += 1", "1:19: missing end or again at end of file"},
+		{"end without if", ": main end", "1:8: end without if ... begin"},
+		{"else without if", ": main else", "1:8: else without if ... begin"},
+		{"again without loop", ": main again", "1:8: again without loop"},
+		{"while outside a loop", ": main while v0 == 1", "1:8: while outside of a loop"},
+		{"if without then or begin", ": main if v0 == 1 v1 := 2", `1:19: expected then or begin, got "v1"`},
+		{"missing main", ": start jump start", "1:1: missing : main label"},
+		{"duplicate label", ": main : main", "1:10: label main is already defined"},
+		{"unexpected end of file", ": main v0 :=", "1:11: unexpected end of file"},
+		{"loop past 12 bits", ": main jump far\n:org 0x1000 : far loop again", "2:24: loop at 0x1000 is out of 12 bit range"},
+		{"while past 12 bits", ": main loop while v0 == 1\n:org 0x1000 again", "2:13: jump target 0x1002 is out of 12 bit range"},
+		{"end past 12 bits", ": main if v0 == 1 begin\n:org 0x1000 end", "2:13: jump target 0x1000 is out of 12 bit range"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := CompileOcto(strings.NewReader(test.source))
+			var asmErr *AsmError
+			if !errors.As(err, &asmErr) {
+				t.Fatalf("got error %v, want %q", err, test.err)
+			}
+			if got := asmErr.Error(); !strings.HasPrefix(got, test.err) {
+				t.Errorf("got error %q, want %q", got, test.err)
+			}
+		})
+	}
+}
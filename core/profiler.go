@@ -0,0 +1,265 @@
+package core
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"slices"
+)
+
+// opcodeClasses lists every instruction form ExecuteInstruction handles and
+// the first platform that has it.
+var opcodeClasses = []struct {
+	name      string
+	extension Extension
+}{
+	{"00E0", CHIP_8}, {"00EE", CHIP_8}, {"1NNN", CHIP_8}, {"2NNN", CHIP_8},
+	{"3XNN", CHIP_8}, {"4XNN", CHIP_8}, {"5XY0", CHIP_8}, {"6XNN", CHIP_8},
+	{"7XNN", CHIP_8}, {"8XY0", CHIP_8}, {"8XY1", CHIP_8}, {"8XY2", CHIP_8},
+	{"8XY3", CHIP_8}, {"8XY4", CHIP_8}, {"8XY5", CHIP_8}, {"8XY6", CHIP_8},
+	{"8XY7", CHIP_8}, {"8XYE", CHIP_8}, {"9XY0", CHIP_8}, {"ANNN", CHIP_8},
+	{"BNNN", CHIP_8}, {"CXNN", CHIP_8}, {"DXYN", CHIP_8}, {"EX9E", CHIP_8},
+	{"EXA1", CHIP_8}, {"FX07", CHIP_8}, {"FX0A", CHIP_8}, {"FX15", CHIP_8},
+	{"FX18", CHIP_8}, {"FX1E", CHIP_8}, {"FX29", CHIP_8}, {"FX33", CHIP_8},
+	{"FX55", CHIP_8}, {"FX65", CHIP_8},
+	{"00CN", SUPERCHIP}, {"00FB", SUPERCHIP}, {"00FC", SUPERCHIP}, {"00FD", SUPERCHIP},
+	{"00FE", SUPERCHIP}, {"00FF", SUPERCHIP}, {"FX30", SUPERCHIP}, {"FX75", SUPERCHIP},
+	{"FX85", SUPERCHIP},
+	{"00DN", XOCHIP}, {"5XY2", XOCHIP}, {"5XY3", XOCHIP}, {"F000", XOCHIP},
+	{"FN01", XOCHIP}, {"F002", XOCHIP}, {"FX3A", XOCHIP},
+}
+
+// opcodeClass names the instruction form of opcode, such as 8XY4.
+func opcodeClass(opcode uint16) string {
+	switch opcode >> 12 {
+	case 0x0:
+		switch opcode & 0xFFF0 {
+		case 0x00C0:
+			return "00CN"
+		case 0x00D0:
+			return "00DN"
+		}
+		return fmt.Sprintf("%04X", opcode)
+	case 0x1, 0x2, 0xA, 0xB:
+		return fmt.Sprintf("%XNNN", opcode>>12)
+	case 0x3, 0x4, 0x6, 0x7, 0xC:
+		return fmt.Sprintf("%XXNN", opcode>>12)
+	case 0x5, 0x8, 0x9:
+		return fmt.Sprintf("%XXY%X", opcode>>12, opcode&0xF)
+	case 0xD:
+		return "DXYN"
+	case 0xE:
+		return fmt.Sprintf("EX%02X", opcode&0xFF)
+	}
+
+	switch {
+	case opcode == 0xF000, opcode == 0xF002:
+		return fmt.Sprintf("%04X", opcode)
+	case opcode&0xFF == 0x01:
+		return "FN01"
+	}
+	return fmt.Sprintf("FX%02X", opcode&0xFF)
+}
+
+// Profiler counts how often each address and each opcode is executed.
+type Profiler struct {
+	addrs   [xochipMemorySize]uint64
+	opcodes [0x10000]uint64
+	total   uint64
+}
+
+func NewProfiler() *Profiler {
+	return &Profiler{}
+}
+
+// SetProfiler starts counting every instruction executed into p. nil stops.
+func (chip8 *CHIP8) SetProfiler(p *Profiler) {
+	chip8.profiler = p
+}
+
+// record counts the instruction at PC.
+func (p *Profiler) record(chip8 *CHIP8) {
+	pc := int(chip8.PC)
+	if pc+1 >= chip8.memorySize() {
+		return
+	}
+
+	p.addrs[pc]++
+	p.opcodes[uint16(chip8.ram[pc])<<8|uint16(chip8.ram[pc+1])]++
+	p.total++
+}
+
+// Report writes a text report for the ROM loaded in chip8: the top hottest
+// addresses, executions per opcode class, reachable instructions that never
+// ran and a coverage map of the ROM image.
+func (p *Profiler) Report(w io.Writer, chip8 *CHIP8, top int) error {
+	out := bufio.NewWriter(w)
+	memory := chip8.Memory()
+
+	fmt.Fprintf(out, "Profile of %s (%s)\n", chip8.romName, chip8.extension)
+	fmt.Fprintf(out, "%d instructions executed\n", p.total)
+
+	// Hottest addresses
+	var addrs []int
+	for addr, count := range p.addrs[:len(memory)] {
+		if count > 0 {
+			addrs = append(addrs, addr)
+		}
+	}
+	slices.SortStableFunc(addrs, func(a, b int) int { return cmp.Compare(p.addrs[b], p.addrs[a]) })
+
+	fmt.Fprintf(out, "\nHottest addresses (%d executed):\n", len(addrs))
+	for _, addr := range addrs[:min(top, len(addrs))] {
+		text, _, ok := Mnemonic(memory[addr:], chip8.extension, chip8.quirks)
+		if !ok {
+			text = "???"
+		}
+		fmt.Fprintf(out, "  %03X  %10d  %5.1f%%  %s\n", addr, p.addrs[addr], 100*float64(p.addrs[addr])/float64(max(p.total, 1)), text)
+	}
+
+	// Opcode classes
+	classes := map[string]uint64{}
+	for opcode, count := range p.opcodes {
+		if count > 0 {
+			classes[opcodeClass(uint16(opcode))] += count
+		}
+	}
+	names := make([]string, 0, len(classes))
+	for name := range classes {
+		names = append(names, name)
+	}
+	slices.SortFunc(names, func(a, b string) int {
+		return cmp.Or(cmp.Compare(classes[b], classes[a]), cmp.Compare(a, b))
+	})
+
+	fmt.Fprintf(out, "\nOpcode classes:\n")
+	for _, name := range names {
+		fmt.Fprintf(out, "  %s  %10d\n", name, classes[name])
+	}
+
+	fmt.Fprintf(out, "\nOpcode classes never executed:")
+	for _, class := range opcodeClasses {
+		if class.extension <= chip8.extension && classes[class.name] == 0 {
+			fmt.Fprintf(out, " %s", class.name)
+		}
+	}
+	fmt.Fprintln(out)
+
+	// Instructions reachable from the entry point that never ran, as ranges
+	rom, base := chip8.rom, int(chip8.entryPoint)
+	flow := traceFlow(rom, base, chip8.extension, chip8.quirks)
+	fmt.Fprintf(out, "\nReachable instructions never executed:\n")
+	for offset := 0; offset < len(rom); offset++ {
+		if flow.code[offset] == 0 || p.addrs[base+offset] > 0 {
+			continue
+		}
+		start, count := offset, 0
+		for offset < len(rom) && flow.code[offset] > 0 && p.addrs[base+offset] == 0 {
+			offset += flow.code[offset]
+			count++
+		}
+		fmt.Fprintf(out, "  %03X-%03X  %d instructions\n", base+start, base+min(offset, len(rom))-1, count)
+	}
+
+	// One character per 2 byte word: # executed, o reachable code that
+	// never ran, . data or unreachable
+	fmt.Fprintf(out, "\nCoverage map (# executed, o not executed, . data):\n")
+	for row := 0; row < len(rom); row += 64 {
+		fmt.Fprintf(out, "  %03X  ", base+row)
+		for offset := row; offset < min(row+64, len(rom)); offset += 2 {
+			switch {
+			case p.addrs[base+offset] > 0 || (offset+1 < len(rom) && p.addrs[base+offset+1] > 0):
+				out.WriteByte('#')
+			case flow.covered[offset]:
+				out.WriteByte('o')
+			default:
+				out.WriteByte('.')
+			}
+		}
+		out.WriteByte('\n')
+	}
+
+	return out.Flush()
+}
+
+// heat maps an execution count to 0 (never) through 1 (hottest) on a log scale.
+func (p *Profiler) heat(count, hottest uint64) float64 {
+	if count == 0 {
+		return 0
+	}
+	return math.Log1p(float64(count)) / math.Log1p(float64(hottest))
+}
+
+func (p *Profiler) hottest(size int) uint64 {
+	return slices.Max(p.addrs[:size])
+}
+
+// heatColor fades from dark blue through red to yellow.
+func heatColor(heat float64) color.RGBA {
+	if heat == 0 {
+		return color.RGBA{0x10, 0x10, 0x20, 0xFF}
+	}
+	return color.RGBA{
+		R: uint8(0x60 + 0x9F*min(heat*2, 1)),
+		G: uint8(0xFF * max(heat*2-1, 0)),
+		B: uint8(0x80 * (1 - heat)),
+		A: 0xFF,
+	}
+}
+
+// WritePNG draws a heatmap of RAM with one square per byte, 64 bytes per row.
+func (p *Profiler) WritePNG(w io.Writer, chip8 *CHIP8) error {
+	const cell = 8
+	size := chip8.memorySize()
+	hottest := p.hottest(size)
+
+	img := image.NewRGBA(image.Rect(0, 0, 64*cell, size/64*cell))
+	for addr := range size {
+		c := heatColor(p.heat(p.addrs[addr], hottest))
+		x, y := addr%64*cell, addr/64*cell
+		for dy := range cell - 1 {
+			for dx := range cell - 1 {
+				img.SetRGBA(x+dx, y+dy, c)
+			}
+		}
+	}
+
+	return png.Encode(w, img)
+}
+
+// WriteHTML writes a heatmap of RAM as a table, 64 bytes per row, with the
+// address, count and instruction of each byte on hover.
+func (p *Profiler) WriteHTML(w io.Writer, chip8 *CHIP8) error {
+	out := bufio.NewWriter(w)
+	memory := chip8.Memory()
+	hottest := p.hottest(len(memory))
+
+	fmt.Fprintf(out, "<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\"><title>%s heatmap</title>\n", html.EscapeString(chip8.romName))
+	fmt.Fprintf(out, "<style>body{background:#111;color:#ccc;font-family:monospace}td{width:10px;height:10px;padding:0}th{font-weight:normal;padding-right:6px}</style></head><body>\n")
+	fmt.Fprintf(out, "<h1>%s</h1><p>%d instructions executed</p>\n<table cellspacing=\"1\">\n", html.EscapeString(chip8.romName), p.total)
+
+	for row := 0; row < len(memory); row += 64 {
+		fmt.Fprintf(out, "<tr><th>%03X</th>", row)
+		for addr := row; addr < row+64; addr++ {
+			c := heatColor(p.heat(p.addrs[addr], hottest))
+			title := fmt.Sprintf("%03X: %d", addr, p.addrs[addr])
+			if p.addrs[addr] > 0 {
+				if text, _, ok := Mnemonic(memory[addr:], chip8.extension, chip8.quirks); ok {
+					title += " " + text
+				}
+			}
+			fmt.Fprintf(out, "<td style=\"background:#%02x%02x%02x\" title=\"%s\"></td>", c.R, c.G, c.B, html.EscapeString(title))
+		}
+		fmt.Fprintf(out, "</tr>\n")
+	}
+
+	fmt.Fprintf(out, "</table></body></html>\n")
+
+	return out.Flush()
+}
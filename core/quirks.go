@@ -0,0 +1,141 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Quirks toggles the behaviours that differ between CHIP8 interpreters.
+// Each flag is independent of the Extension, which only decides which
+// opcodes exist.
+type Quirks struct {
+	VFReset            bool // 8XY1/8XY2/8XY3 reset VF to 0
+	Shifting           bool // 8XY6/8XYE shift VX in place instead of VY into VX
+	MemoryIncrement    bool // FX55/FX65 advance I past the stored registers
+	MemoryIncrementByX bool // With MemoryIncrement, I advances by X instead of X+1 (CHIP-48, SCHIP 1.0)
+	Jumping            bool // BNNN becomes BXNN: jump to XNN + VX
+	Clipping           bool // Sprites are clipped at the screen edges instead of wrapping
+	DisplayWait        bool // Lores DXYN waits for the next 60hz display interrupt
+	RowCollisions      bool // In hires mode DXYN sets VF to the number of rows that collided or were clipped
+}
+
+// quirkFlags maps each quirk's command line name to its field.
+func (q *Quirks) quirkFlags() map[string]*bool {
+	return map[string]*bool{
+		"vfReset":            &q.VFReset,
+		"shifting":           &q.Shifting,
+		"memoryIncrement":    &q.MemoryIncrement,
+		"memoryIncrementByX": &q.MemoryIncrementByX,
+		"jumping":            &q.Jumping,
+		"clipping":           &q.Clipping,
+		"displayWait":        &q.DisplayWait,
+		"rowCollisions":      &q.RowCollisions,
+	}
+}
+
+// Set changes the quirk called name, e.g. "vfReset".
+func (q *Quirks) Set(name string, value bool) error {
+	flag, ok := q.quirkFlags()[name]
+	if !ok {
+		return fmt.Errorf("unknown quirk %q", name)
+	}
+
+	*flag = value
+
+	return nil
+}
+
+// IsQuirk reports whether name is a quirk accepted by Set.
+func IsQuirk(name string) bool {
+	var q Quirks
+	_, ok := q.quirkFlags()[name]
+	return ok
+}
+
+// Profile is a named platform preset: the opcode set plus its quirks.
+type Profile struct {
+	Name      string
+	Title     string
+	Extension Extension
+	Quirks    Quirks
+}
+
+var profiles = map[string]Profile{
+	"vip": {
+		Name:      "vip",
+		Title:     "COSMAC VIP",
+		Extension: CHIP_8,
+		Quirks:    Quirks{VFReset: true, MemoryIncrement: true, Clipping: true, DisplayWait: true},
+	},
+	"chip48": {
+		Name:      "chip48",
+		Title:     "CHIP-48",
+		Extension: CHIP_8,
+		Quirks:    Quirks{Shifting: true, MemoryIncrement: true, MemoryIncrementByX: true, Jumping: true, Clipping: true},
+	},
+	"schip10": {
+		Name:      "schip10",
+		Title:     "SUPER-CHIP 1.0",
+		Extension: SUPERCHIP,
+		Quirks:    Quirks{Shifting: true, MemoryIncrement: true, MemoryIncrementByX: true, Jumping: true, Clipping: true, DisplayWait: true, RowCollisions: true},
+	},
+	"schip11": {
+		Name:      "schip11",
+		Title:     "SUPER-CHIP 1.1",
+		Extension: SUPERCHIP,
+		Quirks:    Quirks{Shifting: true, Jumping: true, Clipping: true, DisplayWait: true, RowCollisions: true},
+	},
+	"schip": {
+		Name:      "schip",
+		Title:     "Modern SUPER-CHIP",
+		Extension: SUPERCHIP,
+		Quirks:    Quirks{Shifting: true, Jumping: true, Clipping: true},
+	},
+	"xochip": {
+		Name:      "xochip",
+		Title:     "XO-CHIP",
+		Extension: XOCHIP,
+		Quirks:    Quirks{MemoryIncrement: true},
+	},
+}
+
+// LookupProfile returns the preset called name, e.g. "vip" or "schip11".
+func LookupProfile(name string) (Profile, error) {
+	if profile, ok := profiles[strings.ToLower(name)]; ok {
+		return profile, nil
+	}
+
+	names := make([]string, 0, len(profiles))
+	for n := range profiles {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	return Profile{}, fmt.Errorf("unknown profile %q, expected one of %s", name, strings.Join(names, ", "))
+}
+
+// DefaultProfile returns the preset used when only an Extension is chosen.
+func DefaultProfile(extension Extension) Profile {
+	switch extension {
+	case SUPERCHIP:
+		return profiles["schip11"]
+	case XOCHIP:
+		return profiles["xochip"]
+	default:
+		return profiles["vip"]
+	}
+}
+
+// incrementI applies the memory increment quirk after FX55/FX65.
+func (chip8 *CHIP8) incrementI() {
+	if !chip8.quirks.MemoryIncrement {
+		return
+	}
+
+	if chip8.quirks.MemoryIncrementByX {
+		chip8.I += uint16(chip8.inst.X)
+	} else {
+		chip8.I += uint16(chip8.inst.X) + 1
+	}
+}
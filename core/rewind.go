@@ -0,0 +1,86 @@
+package core
+
+import "bytes"
+
+// RewindBuffer is a ring buffer of savestates, one per frame, bounded both
+// by a number of frames and by the total bytes held.
+type RewindBuffer struct {
+	states   []*bytes.Buffer // Oldest state at start
+	start    int
+	count    int
+	used     int // Bytes held by the states in the ring
+	maxBytes int
+}
+
+// NewRewindBuffer holds up to frames snapshots using at most maxBytes.
+func NewRewindBuffer(frames int, maxBytes int) *RewindBuffer {
+	return &RewindBuffer{
+		states:   make([]*bytes.Buffer, max(frames, 1)),
+		maxBytes: maxBytes,
+	}
+}
+
+// Push snapshots the machine, dropping the oldest snapshots when the buffer
+// is full or over its memory budget.
+func (rb *RewindBuffer) Push(chip8 *CHIP8) error {
+	if rb.count == len(rb.states) {
+		rb.dropOldest()
+	}
+
+	slot := (rb.start + rb.count) % len(rb.states)
+	buf := rb.states[slot]
+	if buf == nil {
+		buf = new(bytes.Buffer)
+		rb.states[slot] = buf
+	}
+	buf.Reset()
+
+	if err := chip8.SaveState(buf); err != nil {
+		return err
+	}
+	rb.count++
+	rb.used += buf.Len()
+
+	for rb.used > rb.maxBytes && rb.count > 1 {
+		rb.dropOldest()
+	}
+
+	return nil
+}
+
+// Pop restores the most recent snapshot and removes it from the buffer. The
+// keypad keeps its current state so held keys are not replayed. It returns
+// false when there is nothing left to rewind.
+func (rb *RewindBuffer) Pop(chip8 *CHIP8) bool {
+	if rb.count == 0 {
+		return false
+	}
+
+	rb.count--
+	buf := rb.states[(rb.start+rb.count)%len(rb.states)]
+	rb.used -= buf.Len()
+
+	keypad := chip8.keypad
+	if err := chip8.LoadState(bytes.NewReader(buf.Bytes())); err != nil {
+		return false
+	}
+	chip8.keypad = keypad
+
+	return true
+}
+
+// Len returns the number of frames that can be rewound.
+func (rb *RewindBuffer) Len() int {
+	return rb.count
+}
+
+// Clear drops all snapshots.
+func (rb *RewindBuffer) Clear() {
+	rb.start, rb.count, rb.used = 0, 0, 0
+}
+
+func (rb *RewindBuffer) dropOldest() {
+	rb.used -= rb.states[rb.start].Len()
+	rb.start = (rb.start + 1) % len(rb.states)
+	rb.count--
+}
@@ -0,0 +1,192 @@
+package core
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// builtinRomDB describes the ROMs shipped in roms/, in the programs.json
+// format of the community chip8-database.
+//
+//go:embed romdb.json
+var builtinRomDB []byte
+
+// RomInfo is what the ROM database knows about one ROM image. Zero fields
+// are unknown.
+type RomInfo struct {
+	Title    string
+	Authors  []string
+	Profile  Profile          // Platform and quirks, empty Name if none is supported
+	Tickrate uint32           // Instructions per 60hz frame
+	Colors   []uint32         // RGBA background, plane 1, plane 2, both planes
+	Keys     map[string]uint8 // Keypad keys for "up", "down", "left", "right", "a" and "b"
+}
+
+// RomDB maps the SHA-1 of ROM images to their RomInfo.
+type RomDB struct {
+	roms map[[20]uint8]RomInfo
+}
+
+// dbProgram is one program in the chip8-database programs.json, which lists
+// every known release of it under its SHA-1.
+type dbProgram struct {
+	Title   string           `json:"title"`
+	Authors []string         `json:"authors"`
+	Roms    map[string]dbRom `json:"roms"`
+}
+
+type dbRom struct {
+	Tickrate        uint32                     `json:"tickrate"`
+	Colors          dbColors                   `json:"colors"`
+	Platforms       []string                   `json:"platforms"`
+	QuirkyPlatforms map[string]map[string]bool `json:"quirkyPlatforms"`
+	Keys            map[string]uint8           `json:"keys"`
+}
+
+type dbColors struct {
+	Pixels []string `json:"pixels"`
+}
+
+// dbPlatforms maps the chip8-database platform ids to the closest profile.
+// Platforms missing here, like MegaChip, aren't supported.
+var dbPlatforms = map[string]Profile{
+	"originalChip8": profiles["vip"],
+	"hybridVIP":     profiles["vip"],
+	"modernChip8": {
+		Name:      "chip8",
+		Title:     "Modern CHIP-8",
+		Extension: CHIP_8,
+		Quirks:    Quirks{MemoryIncrement: true, Clipping: true},
+	},
+	"chip48":     profiles["chip48"],
+	"superchip1": profiles["schip10"],
+	"superchip":  profiles["schip11"],
+	"xochip":     profiles["xochip"],
+}
+
+// setDBQuirk applies one of the chip8-database quirk names, which don't all
+// map one to one onto Quirks. Quirks the emulator doesn't model are ignored.
+func (q *Quirks) setDBQuirk(name string, value bool) {
+	switch name {
+	case "shift":
+		q.Shifting = value
+	case "memoryIncrementByX":
+		q.MemoryIncrementByX = value
+		if value {
+			q.MemoryIncrement = true
+		}
+	case "memoryLeaveIUnchanged":
+		q.MemoryIncrement = !value
+	case "wrap":
+		q.Clipping = !value
+	case "jump":
+		q.Jumping = value
+	case "vblank":
+		q.DisplayWait = value
+	case "logic":
+		q.VFReset = value
+	}
+}
+
+// parseDBColor parses a "#RRGGBB" color into RGBA.
+func parseDBColor(s string) (uint32, error) {
+	digits := strings.TrimPrefix(s, "#")
+	v, err := strconv.ParseUint(digits, 16, 32)
+	if err != nil || len(digits) != 6 {
+		return 0, fmt.Errorf("invalid color %q", s)
+	}
+	return uint32(v)<<8 | 0xFF, nil
+}
+
+// NewRomDB returns a database holding the built-in entries.
+func NewRomDB() *RomDB {
+	db := &RomDB{roms: map[[20]uint8]RomInfo{}}
+	if err := db.Load(bytes.NewReader(builtinRomDB)); err != nil {
+		panic(fmt.Sprintf("built-in ROM database: %v", err))
+	}
+	return db
+}
+
+// Load adds the programs from a chip8-database programs.json to the
+// database. Entries for ROMs already known replace the old ones, so a user
+// file can override the built-in database. Nothing is added unless the
+// whole document is valid.
+func (db *RomDB) Load(r io.Reader) error {
+	var programs []dbProgram
+	if err := json.NewDecoder(r).Decode(&programs); err != nil {
+		return fmt.Errorf("failed to parse ROM database: %w", err)
+	}
+
+	roms := map[[20]uint8]RomInfo{}
+	for _, program := range programs {
+		for hash, rom := range program.Roms {
+			var sum [20]uint8
+			if n, err := hex.Decode(sum[:], []byte(hash)); err != nil || n != len(sum) {
+				return fmt.Errorf("%s: invalid SHA-1 %q", program.Title, hash)
+			}
+
+			info := RomInfo{
+				Title:    program.Title,
+				Authors:  program.Authors,
+				Tickrate: rom.Tickrate,
+				Keys:     rom.Keys,
+			}
+
+			// The first supported platform wins, with the ROM's own quirks on top
+			for _, platform := range rom.Platforms {
+				profile, ok := dbPlatforms[platform]
+				if !ok {
+					continue
+				}
+				for name, v := range rom.QuirkyPlatforms[platform] {
+					profile.Quirks.setDBQuirk(name, v)
+				}
+				info.Profile = profile
+				break
+			}
+
+			for _, s := range rom.Colors.Pixels {
+				color, err := parseDBColor(s)
+				if err != nil {
+					return fmt.Errorf("%s: %w", program.Title, err)
+				}
+				info.Colors = append(info.Colors, color)
+			}
+
+			roms[sum] = info
+		}
+	}
+
+	maps.Copy(db.roms, roms)
+
+	return nil
+}
+
+// LoadFile is like Load but reads the database from path.
+func (db *RomDB) LoadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open ROM database: %w", err)
+	}
+	defer file.Close()
+
+	if err := db.Load(file); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	return nil
+}
+
+// Lookup returns the entry for the ROM image with SHA-1 hash.
+func (db *RomDB) Lookup(hash [20]uint8) (RomInfo, bool) {
+	info, ok := db.roms[hash]
+	return info, ok
+}
@@ -0,0 +1,91 @@
+package core
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuiltinRomDBCoversBundledROMs(t *testing.T) {
+	db := NewRomDB()
+
+	paths, _ := filepath.Glob("../roms/*/*.ch8")
+	if len(paths) == 0 {
+		t.Fatal("no ROMs found")
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, ok := db.Lookup(sha1.Sum(data))
+		if !ok {
+			t.Errorf("%s: not in the built-in database", path)
+			continue
+		}
+		if info.Profile.Name == "" {
+			t.Errorf("%s: no supported platform", path)
+		}
+	}
+}
+
+func TestRomDBLoadOverrides(t *testing.T) {
+	const hash = "5f518084744bf3cb8733f6e5454dfd1634320563" // Tetris
+	db := NewRomDB()
+
+	err := db.Load(strings.NewReader(`[{"title": "Tetris (tuned)", "roms": {"` + hash + `": {
+		"tickrate": 20,
+		"platforms": ["megachip8", "superchip"],
+		"quirkyPlatforms": {"superchip": {"wrap": true, "logic": true, "memoryLeaveIUnchanged": false}},
+		"colors": {"pixels": ["#102030", "#FFCC00"]},
+		"keys": {"left": 5}}}}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sum [20]uint8
+	hex.Decode(sum[:], []byte(hash))
+	info, ok := db.Lookup(sum)
+	if !ok {
+		t.Fatal("entry missing after Load")
+	}
+
+	want := profiles["schip11"].Quirks
+	want.Clipping, want.VFReset, want.MemoryIncrement = false, true, true
+	expect(t, "title", info.Title, "Tetris (tuned)")
+	expect(t, "extension", info.Profile.Extension, SUPERCHIP)
+	expect(t, "quirks", info.Profile.Quirks, want)
+	expect(t, "tickrate", info.Tickrate, 20)
+	expect(t, "colors", len(info.Colors), 2)
+	expect(t, "background", info.Colors[0], 0x102030FF)
+	expect(t, "left", info.Keys["left"], 5)
+}
+
+func TestRomDBLoadErrors(t *testing.T) {
+	for _, data := range []string{
+		`{"not": "a list"}`,
+		`[{"title": "x", "roms": {"1234": {}}}]`,
+		`[{"title": "x", "roms": {"5f518084744bf3cb8733f6e5454dfd1634320563": {"colors": {"pixels": ["red"]}}}}]`,
+	} {
+		if err := NewRomDB().Load(strings.NewReader(data)); err == nil {
+			t.Errorf("Load(%s) succeeded, want an error", data)
+		}
+	}
+}
+
+func TestRomDBLoadFailureAddsNothing(t *testing.T) {
+	db := NewRomDB()
+	err := db.Load(strings.NewReader(`[
+		{"title": "good", "roms": {"0000000000000000000000000000000000000001": {"tickrate": 5}}},
+		{"title": "bad", "roms": {"1234": {}}}]`))
+	if err == nil {
+		t.Fatal("Load succeeded, want an error")
+	}
+
+	if _, ok := db.Lookup([20]uint8{19: 1}); ok {
+		t.Error("valid entry before the error was added")
+	}
+}
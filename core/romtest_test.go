@@ -0,0 +1,176 @@
+package core
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var (
+	goldenDir    = flag.String("golden", "../roms/tests/golden", "directory of the golden screens")
+	updateGolden = flag.Bool("update", false, "rewrite the golden screens instead of checking them")
+)
+
+// testInstsPerFrame is the fixed speed of test runs, so golden screens don't
+// depend on instsPerSecond.
+const testInstsPerFrame = 16
+
+// keyPress holds key down from frame for frames frames.
+type keyPress struct {
+	frame  int
+	key    uint8
+	frames int
+}
+
+// romTest runs a ROM with a platform profile and scripted keypad input, then
+// compares the display with the golden screen name.txt.
+type romTest struct {
+	name    string
+	rom     string
+	profile string
+	frames  int
+	keys    []keyPress
+	skip    string // Why the test can't run, if it can't
+}
+
+// romTests cover the Timendus test suite in roms/tests. The menus in 5-quirks
+// and 6-keypad pick an entry with its number key. 5-quirks runs once per
+// platform profile it can check: CHIP-8 is entry 1, XO-CHIP entry 3, and
+// SUPER-CHIP entry 2 followed by 1 for modern or 2 for legacy (1.1) behaviour.
+var romTests = []romTest{
+	{name: "1-chip8-logo", rom: "1-chip8-logo.ch8", profile: "vip", frames: 120},
+	{name: "2-ibm-logo", rom: "2-ibm-logo.ch8", profile: "vip", frames: 120},
+	{name: "3-corax+", rom: "3-corax+.ch8", profile: "vip", frames: 300},
+	{name: "4-flags", rom: "4-flags.ch8", profile: "vip", frames: 300},
+	{name: "5-quirks-vip", rom: "5-quirks.ch8", profile: "vip", frames: 2000,
+		keys: []keyPress{{130, 0x1, 5}}},
+	{name: "5-quirks-chip48", rom: "5-quirks.ch8", profile: "chip48",
+		skip: "the ROM's menu has no CHIP-48 entry, and its CHIP-8 checks expect COSMAC VIP quirks"},
+	{name: "5-quirks-schip10", rom: "5-quirks.ch8", profile: "schip10",
+		skip: "the ROM's legacy SUPER-CHIP checks are for 1.1, which leaves I unchanged where 1.0 adds X"},
+	{name: "5-quirks-schip11", rom: "5-quirks.ch8", profile: "schip11", frames: 2000,
+		keys: []keyPress{{130, 0x2, 5}, {200, 0x2, 5}}},
+	{name: "5-quirks-schip", rom: "5-quirks.ch8", profile: "schip", frames: 2000,
+		keys: []keyPress{{130, 0x2, 5}, {200, 0x1, 5}}},
+	{name: "5-quirks-xochip", rom: "5-quirks.ch8", profile: "xochip", frames: 2000,
+		keys: []keyPress{{130, 0x3, 5}}},
+	{name: "6-keypad-down", rom: "6-keypad.ch8", profile: "vip", frames: 300,
+		keys: []keyPress{{130, 0x1, 5}, {250, 0x5, 50}}},
+	{name: "6-keypad-up", rom: "6-keypad.ch8", profile: "vip", frames: 300,
+		keys: []keyPress{{130, 0x2, 5}, {250, 0x5, 50}}},
+	{name: "6-keypad-getkey", rom: "6-keypad.ch8", profile: "vip", frames: 300,
+		keys: []keyPress{{130, 0x3, 5}, {200, 0x5, 10}}},
+	{name: "7-beep", rom: "7-beep.ch8", profile: "vip", frames: 120},
+}
+
+// screen renders the display as text, one line per row: '.' for unlit
+// pixels, '#' for plane 1 and '2' or '3' for the other XO-CHIP planes.
+func screen(fb Framebuffer) []byte {
+	var text bytes.Buffer
+	for y := range fb.Height() {
+		for x := range fb.Width() {
+			text.WriteByte(".#23"[fb.Pixel(x, y)&0x3])
+		}
+		text.WriteByte('\n')
+	}
+	return text.Bytes()
+}
+
+// failMark is the cross the test ROMs draw next to a failed check, with a
+// blank border. The border keeps the font's taller x from matching.
+var failMark = [][]byte{
+	[]byte("....."),
+	[]byte(".#.#."),
+	[]byte("..#.."),
+	[]byte(".#.#."),
+	[]byte("....."),
+}
+
+// hasFailMark reports whether the screen shows a failed check.
+func hasFailMark(screen []byte) bool {
+	rows := bytes.Split(screen, []byte("\n"))
+	for y := 0; y+len(failMark) <= len(rows); y++ {
+		for x := 0; x+len(failMark[0]) <= len(rows[y]); x++ {
+			match := true
+			for i, mark := range failMark {
+				if len(rows[y+i]) < x+len(mark) || !bytes.Equal(rows[y+i][x:x+len(mark)], mark) {
+					match = false
+					break
+				}
+			}
+			if match {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// run plays the test and returns the final screen.
+func (rt *romTest) run(t *testing.T) []byte {
+	t.Helper()
+
+	profile, err := LookupProfile(rt.profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var chip8 CHIP8
+	if err := chip8.Init(filepath.Join("../roms/tests", rt.rom), profile.Extension, profile.Quirks); err != nil {
+		t.Fatal(err)
+	}
+
+	for frame := range rt.frames {
+		for _, press := range rt.keys {
+			switch frame {
+			case press.frame:
+				chip8.SetKey(press.key, true)
+			case press.frame + press.frames:
+				chip8.SetKey(press.key, false)
+			}
+		}
+
+		if err := chip8.RunFrame(testInstsPerFrame); err != nil {
+			t.Fatalf("frame %d: %v", frame, err)
+		}
+		chip8.UpdateTimers()
+	}
+
+	return screen(&chip8)
+}
+
+// TestROMGoldens plays every ROM test and compares its screen with the golden
+// screens, or rewrites them with -update. A screen showing a failed check is
+// an error either way, so a failure can't become a golden.
+func TestROMGoldens(t *testing.T) {
+	for _, rt := range romTests {
+		t.Run(rt.name, func(t *testing.T) {
+			if rt.skip != "" {
+				t.Skip(rt.skip)
+			}
+
+			path := filepath.Join(*goldenDir, rt.name+".txt")
+			got := rt.run(t)
+			if hasFailMark(got) {
+				t.Fatalf("screen shows a failed check:\n%s", got)
+			}
+
+			if *updateGolden {
+				if err := os.WriteFile(path, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			golden, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, golden) {
+				t.Errorf("screen differs from %s, got:\n%s", path, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,259 @@
+package core
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Savestate files start with stateMagic and a version number, followed by
+// a fixed size stateHeader, the platform's RAM and the display planes. Since
+// version 2 these are followed by a randomState and the random source's
+// binary state, and since version 3 by a keyWaitState. Bump stateVersion
+// whenever the layout changes.
+const (
+	stateMagic   = "CH8S"
+	stateVersion = 3
+)
+
+var (
+	ErrStateFormat      = errors.New("not a CHIP8 savestate")
+	ErrStateVersion     = errors.New("unsupported savestate version")
+	ErrStateRomMismatch = errors.New("savestate was made with a different ROM")
+)
+
+// stateHeader holds every fixed size field of the machine state, in the
+// exact layout written to disk.
+type stateHeader struct {
+	RomHash      [20]uint8
+	Extension    uint8
+	Quirks       Quirks
+	V            [16]uint8
+	I            uint16
+	PC           uint16
+	Stack        [16]uint16
+	StackPointer uint8
+	DelayTimer   uint8
+	SoundTimer   uint8
+	Keypad       [16]bool
+	RPL          [16]uint8
+	Hires        bool
+	Planes       uint8
+	AudioPattern [16]uint8
+	HasPattern   bool
+	Pitch        uint8
+	CycleDebt    int32
+	MemorySize   uint32
+}
+
+// randomState precedes the random source's own binary state.
+type randomState struct {
+	Seed   uint64
+	Length uint16
+}
+
+// keyWaitState is the key an FX0A in progress is waiting to be released.
+type keyWaitState struct {
+	Held bool
+	Key  uint8
+}
+
+// SaveState writes the full machine state to w.
+func (chip8 *CHIP8) SaveState(w io.Writer) error {
+	header := stateHeader{
+		RomHash:      chip8.romHash,
+		Extension:    uint8(chip8.extension),
+		Quirks:       chip8.quirks,
+		V:            chip8.V,
+		I:            chip8.I,
+		PC:           chip8.PC,
+		Stack:        chip8.stack,
+		StackPointer: chip8.stackPointer,
+		DelayTimer:   chip8.delayTimer,
+		SoundTimer:   chip8.soundTimer,
+		Keypad:       chip8.keypad,
+		RPL:          chip8.rpl,
+		Hires:        chip8.hires,
+		Planes:       chip8.planes,
+		AudioPattern: chip8.audioPattern,
+		HasPattern:   chip8.hasPattern,
+		Pitch:        chip8.pitch,
+		CycleDebt:    int32(chip8.cycleDebt),
+		MemorySize:   uint32(chip8.memorySize()),
+	}
+
+	if _, err := io.WriteString(w, stateMagic); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, uint16(stateVersion)); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, &header); err != nil {
+		return err
+	}
+	if _, err := w.Write(chip8.ram[:header.MemorySize]); err != nil {
+		return err
+	}
+	if _, err := w.Write(chip8.display[:]); err != nil {
+		return err
+	}
+
+	random, err := chip8.random.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, randomState{chip8.seed, uint16(len(random))}); err != nil {
+		return err
+	}
+	if _, err := w.Write(random); err != nil {
+		return err
+	}
+
+	return binary.Write(w, binary.LittleEndian, keyWaitState{chip8.keyHeld, chip8.heldKey})
+}
+
+// LoadState restores a machine state written by SaveState. The state must
+// have been saved while running the same ROM. Version 1 states carry no
+// random source state and leave it as it is, and states before version 3
+// restore no FX0A in progress.
+func (chip8 *CHIP8) LoadState(r io.Reader) error {
+	magic := make([]uint8, len(stateMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != stateMagic {
+		return ErrStateFormat
+	}
+
+	var version uint16
+	if err := binary.Read(r, binary.LittleEndian, &version); err != nil {
+		return ErrStateFormat
+	}
+	if version < 1 || version > stateVersion {
+		return fmt.Errorf("%w: %d", ErrStateVersion, version)
+	}
+
+	var header stateHeader
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return fmt.Errorf("%w: %v", ErrStateFormat, err)
+	}
+	if header.RomHash != chip8.romHash {
+		return ErrStateRomMismatch
+	}
+	extension := Extension(header.Extension)
+	if _, ok := extensionNames[extension]; !ok {
+		return fmt.Errorf("%w: unknown extension %d", ErrStateFormat, header.Extension)
+	}
+	if header.MemorySize != uint32(extension.memorySize()) {
+		return fmt.Errorf("%w: memory size %d on %v", ErrStateFormat, header.MemorySize, extension)
+	}
+	if int(header.StackPointer) > extension.stackDepth() {
+		return fmt.Errorf("%w: stack pointer %d on %v", ErrStateFormat, header.StackPointer, extension)
+	}
+	if header.Planes > 3 {
+		return fmt.Errorf("%w: planes %d", ErrStateFormat, header.Planes)
+	}
+
+	// Read and check everything before touching the machine so a bad file leaves it intact
+	ram := make([]uint8, header.MemorySize)
+	if _, err := io.ReadFull(r, ram); err != nil {
+		return fmt.Errorf("%w: %v", ErrStateFormat, err)
+	}
+	var display [HiresWidth * HiresHeight]uint8
+	if _, err := io.ReadFull(r, display[:]); err != nil {
+		return fmt.Errorf("%w: %v", ErrStateFormat, err)
+	}
+
+	var rs randomState
+	var random []uint8
+	if version >= 2 {
+		if err := binary.Read(r, binary.LittleEndian, &rs); err != nil {
+			return fmt.Errorf("%w: %v", ErrStateFormat, err)
+		}
+		random = make([]uint8, rs.Length)
+		if _, err := io.ReadFull(r, random); err != nil {
+			return fmt.Errorf("%w: %v", ErrStateFormat, err)
+		}
+	}
+
+	var keyWait keyWaitState
+	if version >= 3 {
+		if err := binary.Read(r, binary.LittleEndian, &keyWait); err != nil {
+			return fmt.Errorf("%w: %v", ErrStateFormat, err)
+		}
+	}
+
+	// The random source is the only part that can still reject the state
+	if version >= 2 {
+		if err := chip8.random.UnmarshalBinary(random); err != nil {
+			return fmt.Errorf("%w: %v", ErrStateFormat, err)
+		}
+		chip8.seed = rs.Seed
+	}
+
+	chip8.extension = extension
+	chip8.quirks = header.Quirks
+	chip8.V = header.V
+	chip8.I = header.I
+	chip8.PC = header.PC
+	chip8.stack = header.Stack
+	chip8.stackPointer = header.StackPointer
+	chip8.delayTimer = header.DelayTimer
+	chip8.soundTimer = header.SoundTimer
+	chip8.keypad = header.Keypad
+	chip8.keyHeld, chip8.heldKey = keyWait.Held, keyWait.Key&0xF
+	chip8.rpl = header.RPL
+	chip8.hires = header.Hires
+	chip8.planes = header.Planes
+	chip8.audioPattern = header.AudioPattern
+	chip8.hasPattern = header.HasPattern
+	chip8.pitch = header.Pitch
+	chip8.cycleDebt = int(header.CycleDebt)
+
+	chip8.ram = [xochipMemorySize]uint8{}
+	copy(chip8.ram[:], ram)
+	chip8.display = display
+
+	chip8.vblankWait = false
+	chip8.fault = nil
+	if chip8.state == FAULTED {
+		chip8.state = RUNNING
+	}
+
+	return nil
+}
+
+// SaveStateFile writes the machine state to the file at path.
+func (chip8 *CHIP8) SaveStateFile(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create savestate: %w", err)
+	}
+
+	w := bufio.NewWriter(file)
+	if err := chip8.SaveState(w); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write savestate: %w", err)
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write savestate: %w", err)
+	}
+
+	return file.Close()
+}
+
+// LoadStateFile restores the machine state from the file at path.
+func (chip8 *CHIP8) LoadStateFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open savestate: %w", err)
+	}
+	defer file.Close()
+
+	if err := chip8.LoadState(bufio.NewReader(file)); err != nil {
+		return fmt.Errorf("failed to load savestate %s: %w", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func TestSaveStateRoundTrip(t *testing.T) {
+	c := newTestMachine(XOCHIP, profiles["xochip"].Quirks, []uint8{0x60, 0x05, 0x61, 0x2A, 0x22, 0x08, 0x12, 0x06, 0x00, 0xEE})
+	if err := c.RunFrame(3); err != nil {
+		t.Fatal(err)
+	}
+
+	var state bytes.Buffer
+	if err := c.SaveState(&state); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := newTestMachine(CHIP_8, vip, nil)
+	loaded.romHash = c.romHash
+	if err := loaded.LoadState(&state); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "registers", loaded.Registers(), c.Registers())
+	expect(t, "extension", loaded.extension, XOCHIP)
+	if !bytes.Equal(loaded.ram[:], c.ram[:]) {
+		t.Error("ram differs after loading")
+	}
+}
+
+func TestLoadStateRejectsInvalidHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(header *stateHeader)
+		err    error
+	}{
+		{"valid", func(h *stateHeader) {}, nil},
+		{"unknown extension", func(h *stateHeader) { h.Extension = 3 }, ErrStateFormat},
+		{"stack pointer past chip8 depth", func(h *stateHeader) { h.StackPointer = 13 }, ErrStateFormat},
+		{"stack pointer past stack", func(h *stateHeader) { h.Extension, h.StackPointer = uint8(SUPERCHIP), 17 }, ErrStateFormat},
+		{"planes", func(h *stateHeader) { h.Planes = 4 }, ErrStateFormat},
+		{"memory size of another platform", func(h *stateHeader) { h.Extension = uint8(XOCHIP) }, ErrStateFormat},
+		{"memory size too small", func(h *stateHeader) { h.MemorySize = 0x200 }, ErrStateFormat},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := newTestMachine(CHIP_8, vip, []uint8{0x60, 0x05, 0x60, 0x09})
+			if err := c.ExecuteInstruction(); err != nil {
+				t.Fatal(err)
+			}
+
+			var saved bytes.Buffer
+			if err := c.SaveState(&saved); err != nil {
+				t.Fatal(err)
+			}
+			if err := c.ExecuteInstruction(); err != nil {
+				t.Fatal(err)
+			}
+
+			// Rewrite the header, keeping the RAM and everything after it
+			state := saved.Bytes()
+			offset := len(stateMagic) + 2
+			var header stateHeader
+			if _, err := binary.Decode(state[offset:], binary.LittleEndian, &header); err != nil {
+				t.Fatal(err)
+			}
+			test.modify(&header)
+			if _, err := binary.Encode(state[offset:], binary.LittleEndian, &header); err != nil {
+				t.Fatal(err)
+			}
+
+			err := c.LoadState(bytes.NewReader(state))
+			if !errors.Is(err, test.err) {
+				t.Fatalf("got error %v, want %v", err, test.err)
+			}
+			if test.err == nil {
+				expectV(t, c, 0, 0x05)
+				return
+			}
+			expectV(t, c, 0, 0x09)
+			expectPC(t, c, 0x204)
+			expect(t, "extension", c.extension, CHIP_8)
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package core
+
+// setHires switches between 64x32 and 128x64 mode. The whole display is
+// cleared because the row stride changes.
+func (chip8 *CHIP8) setHires(hires bool) {
+	chip8.hires = hires
+	chip8.display = [HiresWidth * HiresHeight]uint8{}
+}
+
+// movePixel copies the selected planes of pixel src into pixel dst.
+// A negative src blanks the selected planes of dst.
+func (chip8 *CHIP8) movePixel(dst, src int) {
+	var bits uint8
+	if src >= 0 {
+		bits = chip8.display[src] & chip8.planes
+	}
+	chip8.display[dst] = chip8.display[dst]&^chip8.planes | bits
+}
+
+// scrollDown moves the display down n rows, filling the top with blank rows.
+func (chip8 *CHIP8) scrollDown(n int) {
+	width, height := chip8.Width(), chip8.Height()
+
+	for y := height - 1; y >= 0; y-- {
+		for x := 0; x < width; x++ {
+			if y >= n {
+				chip8.movePixel(y*width+x, (y-n)*width+x)
+			} else {
+				chip8.movePixel(y*width+x, -1)
+			}
+		}
+	}
+}
+
+// scrollUp moves the display up n rows, filling the bottom with blank rows.
+func (chip8 *CHIP8) scrollUp(n int) {
+	width, height := chip8.Width(), chip8.Height()
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if y+n < height {
+				chip8.movePixel(y*width+x, (y+n)*width+x)
+			} else {
+				chip8.movePixel(y*width+x, -1)
+			}
+		}
+	}
+}
+
+// scrollRight moves the display right n columns, filling the left edge with blank pixels.
+func (chip8 *CHIP8) scrollRight(n int) {
+	width, height := chip8.Width(), chip8.Height()
+
+	for y := 0; y < height; y++ {
+		for x := width - 1; x >= 0; x-- {
+			if x >= n {
+				chip8.movePixel(y*width+x, y*width+x-n)
+			} else {
+				chip8.movePixel(y*width+x, -1)
+			}
+		}
+	}
+}
+
+// scrollLeft moves the display left n columns, filling the right edge with blank pixels.
+func (chip8 *CHIP8) scrollLeft(n int) {
+	width, height := chip8.Width(), chip8.Height()
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if x+n < width {
+				chip8.movePixel(y*width+x, y*width+x+n)
+			} else {
+				chip8.movePixel(y*width+x, -1)
+			}
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package core
+
+// COSMAC VIP timing. The 1802 runs at 1.76 MHz with 8 clock pulses per
+// machine cycle, and every 60hz frame the display interrupt and its DMA
+// steal part of that budget from the CHIP8 interpreter.
+const (
+	vipClockHz         = 1760640
+	vipClocksPerCycle  = 8
+	vipCyclesPerFrame  = vipClockHz / vipClocksPerCycle / 60 // 3668
+	vipDisplayCycles   = 128*8 + 46                          // DMA for 128 scanlines plus the interrupt routine
+	vipCPUFrameCycles  = vipCyclesPerFrame - vipDisplayCycles
+	vipSkipCycles      = 2    // Extra cost when a skip instruction is taken
+	vipClearCycles     = 3078 // 00E0 clears 256 bytes of display memory one at a time
+	vipSpriteCycles    = 68   // DXYN setup before the first row
+	vipSpriteRowCycles = 46   // DXYN per byte-aligned row
+	vipSpriteBitCycles = 16   // DXYN per row, per bit the row is shifted right
+)
+
+// RunVIPFrame executes one 60hz frame worth of COSMAC VIP machine cycles,
+// charging each instruction its real cost. Cycles overspent by a slow
+// instruction are paid back from the next frame.
+func (chip8 *CHIP8) RunVIPFrame() error {
+	chip8.vblankWait = false
+	budget := vipCPUFrameCycles + chip8.cycleDebt
+
+	for budget > 0 && chip8.state == RUNNING {
+		if chip8.shouldBreak() {
+			chip8.cycleDebt = min(budget, 0)
+			return ErrBreak
+		}
+
+		startPC := chip8.PC
+		opcode := uint16(chip8.ram[chip8.PC])<<8 | uint16(chip8.ram[chip8.PC+1])
+		cycles := chip8.vipCycles(opcode)
+
+		if err := chip8.ExecuteInstruction(); err != nil {
+			// Faults and watchpoints still spent the cycles, and the old debt is paid
+			budget -= cycles
+			chip8.cycleDebt = min(budget, 0)
+			return err
+		}
+
+		switch opcode >> 12 {
+		case 0x3, 0x4, 0x5, 0x9, 0xE:
+			if chip8.PC == startPC+4 {
+				cycles += vipSkipCycles
+			}
+		}
+		budget -= cycles
+
+		if chip8.vblankWait {
+			break
+		}
+	}
+
+	chip8.cycleDebt = min(budget, 0)
+
+	return nil
+}
+
+// vipCycles returns the machine cycles the VIP interpreter spends on opcode,
+// including its fetch and decode overhead. Costs depending on the machine
+// state are taken before the instruction executes.
+func (chip8 *CHIP8) vipCycles(opcode uint16) int {
+	x := (opcode >> 8) & 0xF
+
+	switch opcode >> 12 {
+	case 0x0:
+		if opcode == 0x00E0 {
+			return 24 + vipClearCycles
+		}
+		return 24
+	case 0x1, 0x2, 0xB:
+		return 23
+	case 0x3, 0x4, 0xA:
+		return 12
+	case 0x5, 0x9, 0xE:
+		return 16
+	case 0x6:
+		return 6
+	case 0x7:
+		return 10
+	case 0x8:
+		return 44
+	case 0xC:
+		return 36
+	case 0xD:
+		return chip8.vipSpriteCycles(opcode)
+	case 0xF:
+		switch opcode & 0xFF {
+		case 0x1E:
+			return 19
+		case 0x29:
+			return 20
+		case 0x33:
+			return 204
+		case 0x55, 0x65:
+			return 14 + 14*int(x+1)
+		default:
+			return 10
+		}
+	}
+
+	return 10
+}
+
+// vipSpriteCycles models DXYN: each drawn row costs more the further X is
+// from a byte boundary, because the VIP shifts sprite bytes one bit at a time.
+func (chip8 *CHIP8) vipSpriteCycles(opcode uint16) int {
+	xCoord := int(chip8.V[(opcode>>8)&0xF]) % DisplayWidth
+	yCoord := int(chip8.V[(opcode>>4)&0xF]) % DisplayHeight
+
+	rows := int(opcode & 0xF)
+	if chip8.quirks.Clipping && yCoord+rows > DisplayHeight {
+		rows = DisplayHeight - yCoord
+	}
+
+	return vipSpriteCycles + rows*(vipSpriteRowCycles+vipSpriteBitCycles*(xCoord%8))
+}
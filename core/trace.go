@@ -0,0 +1,158 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DefaultTraceFormat is the field list used when none is given.
+const DefaultTraceFormat = "frame,pc,opcode,mnemonic,v,i"
+
+// traceFields formats each field a trace line can contain, from the state
+// before the instruction runs.
+var traceFields = map[string]func(t *Trace, chip8 *CHIP8, code []uint8) string{
+	"frame": func(t *Trace, _ *CHIP8, _ []uint8) string {
+		return fmt.Sprintf("%d", t.frame)
+	},
+	"pc": func(_ *Trace, chip8 *CHIP8, _ []uint8) string {
+		return fmt.Sprintf("%03X", chip8.PC)
+	},
+	"opcode": func(_ *Trace, _ *CHIP8, code []uint8) string {
+		return fmt.Sprintf("%02X%02X", code[0], code[1])
+	},
+	"mnemonic": func(_ *Trace, chip8 *CHIP8, code []uint8) string {
+		text, _, ok := Mnemonic(code, chip8.extension, chip8.quirks)
+		if !ok {
+			text = "???"
+		}
+		return fmt.Sprintf("%-18s", text)
+	},
+	"v": func(_ *Trace, chip8 *CHIP8, _ []uint8) string {
+		return fmt.Sprintf("V:% X", chip8.V[:])
+	},
+	"i": func(_ *Trace, chip8 *CHIP8, _ []uint8) string {
+		return fmt.Sprintf("I:%03X", chip8.I)
+	},
+	"sp": func(_ *Trace, chip8 *CHIP8, _ []uint8) string {
+		return fmt.Sprintf("SP:%d", chip8.stackPointer)
+	},
+	"dt": func(_ *Trace, chip8 *CHIP8, _ []uint8) string {
+		return fmt.Sprintf("DT:%d", chip8.delayTimer)
+	},
+	"st": func(_ *Trace, chip8 *CHIP8, _ []uint8) string {
+		return fmt.Sprintf("ST:%d", chip8.soundTimer)
+	},
+}
+
+// traceRange is an inclusive range of PC values to trace.
+type traceRange struct {
+	start, end int
+}
+
+// Trace writes one line per executed instruction, with the machine state
+// from before the instruction ran. In ring mode only the most recent lines
+// are kept, and written out by Flush.
+type Trace struct {
+	w       *bufio.Writer
+	fields  []string
+	filters []traceRange
+	frame   uint64
+	ring    []string
+	ringPos int
+	ringLen int
+}
+
+// NewTrace creates a trace writing to w. format is a comma separated list of
+// fields: frame, pc, opcode, mnemonic, v, i, sp, dt and st.
+func NewTrace(w io.Writer, format string) (*Trace, error) {
+	t := &Trace{w: bufio.NewWriter(w)}
+
+	for _, field := range strings.Split(format, ",") {
+		field = strings.ToLower(strings.TrimSpace(field))
+		if _, ok := traceFields[field]; !ok {
+			return nil, fmt.Errorf("unknown trace field %q", field)
+		}
+		t.fields = append(t.fields, field)
+	}
+
+	return t, nil
+}
+
+// AddFilter limits tracing to instructions with start <= PC <= end. With
+// several filters, an instruction in any of them is traced.
+func (t *Trace) AddFilter(start, end int) {
+	t.filters = append(t.filters, traceRange{start, end})
+}
+
+// SetRing keeps only the last n lines in memory until Flush. 0 writes every
+// line straight away.
+func (t *Trace) SetRing(n int) {
+	t.ring = make([]string, n)
+	t.ringPos, t.ringLen = 0, 0
+}
+
+// NextFrame advances the frame number printed in trace lines.
+func (t *Trace) NextFrame() {
+	t.frame++
+}
+
+// Flush writes out the lines held in ring mode and flushes the writer.
+func (t *Trace) Flush() error {
+	if len(t.ring) > 0 {
+		start := (t.ringPos - t.ringLen + len(t.ring)) % len(t.ring)
+		for i := range t.ringLen {
+			if _, err := t.w.WriteString(t.ring[(start+i)%len(t.ring)]); err != nil {
+				return err
+			}
+		}
+		t.ringLen = 0
+	}
+
+	return t.w.Flush()
+}
+
+// record traces the instruction at PC.
+func (t *Trace) record(chip8 *CHIP8) {
+	pc := int(chip8.PC)
+
+	if len(t.filters) > 0 {
+		traced := false
+		for _, r := range t.filters {
+			if pc >= r.start && pc <= r.end {
+				traced = true
+				break
+			}
+		}
+		if !traced {
+			return
+		}
+	}
+
+	// Past the end of RAM the fetch faults; trace it as a zero opcode
+	code := make([]uint8, 4)
+	if pc < chip8.memorySize() {
+		copy(code, chip8.ram[pc:chip8.memorySize()])
+	}
+
+	parts := make([]string, len(t.fields))
+	for i, field := range t.fields {
+		parts[i] = traceFields[field](t, chip8, code)
+	}
+	line := strings.TrimRight(strings.Join(parts, "  "), " ") + "\n"
+
+	if len(t.ring) == 0 {
+		t.w.WriteString(line)
+		return
+	}
+
+	t.ring[t.ringPos] = line
+	t.ringPos = (t.ringPos + 1) % len(t.ring)
+	t.ringLen = min(t.ringLen+1, len(t.ring))
+}
+
+// SetTrace starts tracing every instruction executed into t. nil stops.
+func (chip8 *CHIP8) SetTrace(t *Trace) {
+	chip8.trace = t
+}
@@ -0,0 +1,149 @@
+package core
+
+import (
+	"fmt"
+	"slices"
+)
+
+// WatchTarget selects what a Watchpoint observes.
+type WatchTarget uint8
+
+const (
+	WatchMemory   WatchTarget = iota // RAM accesses made by an instruction, not opcode fetches
+	WatchRegister                    // A V register changing
+	WatchIndex                       // I changing
+)
+
+// Watchpoint stops execution after an instruction that touches a watched
+// memory range or changes a watched register.
+type Watchpoint struct {
+	Target   WatchTarget
+	Start    int    // WatchMemory: first address of the range
+	End      int    // WatchMemory: last address of the range, inclusive
+	Read     bool   // WatchMemory: trigger on reads
+	Write    bool   // WatchMemory: trigger on writes
+	Register uint8  // WatchRegister: index of the V register
+	Match    bool   // Only trigger when the value read, written or now held equals Value
+	Value    uint16 // Value compared against when Match is set
+}
+
+func (wp Watchpoint) String() string {
+	var s string
+	switch wp.Target {
+	case WatchMemory:
+		access := ""
+		if wp.Read {
+			access += "r"
+		}
+		if wp.Write {
+			access += "w"
+		}
+		s = fmt.Sprintf("%s 0x%03X", access, wp.Start)
+		if wp.End != wp.Start {
+			s += fmt.Sprintf("-0x%03X", wp.End)
+		}
+	case WatchRegister:
+		s = fmt.Sprintf("V%X", wp.Register)
+	case WatchIndex:
+		s = "I"
+	}
+
+	if wp.Match {
+		s += fmt.Sprintf(" == 0x%02X", wp.Value)
+	}
+
+	return s
+}
+
+// WatchHit is returned by ExecuteInstruction, and so by RunFrame and
+// RunVIPFrame, once an instruction triggers a watchpoint. PC already points
+// at the following instruction. It unwraps to ErrBreak.
+type WatchHit struct {
+	Watchpoint Watchpoint
+	PC         uint16 // Address of the instruction that triggered it
+	Address    int    // Memory address accessed, for WatchMemory
+	Write      bool   // The access was a write, for WatchMemory
+	Value      uint16 // Value read, written, or now held by the register
+}
+
+func (h *WatchHit) Error() string {
+	switch h.Watchpoint.Target {
+	case WatchMemory:
+		if h.Write {
+			return fmt.Sprintf("watchpoint: wrote 0x%02X to 0x%03X at PC 0x%03X", h.Value, h.Address, h.PC)
+		}
+		return fmt.Sprintf("watchpoint: read 0x%02X from 0x%03X at PC 0x%03X", h.Value, h.Address, h.PC)
+	case WatchRegister:
+		return fmt.Sprintf("watchpoint: V%X = 0x%02X at PC 0x%03X", h.Watchpoint.Register, h.Value, h.PC)
+	default:
+		return fmt.Sprintf("watchpoint: I = 0x%03X at PC 0x%03X", h.Value, h.PC)
+	}
+}
+
+func (h *WatchHit) Unwrap() error {
+	return ErrBreak
+}
+
+// AddWatchpoint starts watching wp.
+func (chip8 *CHIP8) AddWatchpoint(wp Watchpoint) {
+	chip8.watchpoints = append(chip8.watchpoints, wp)
+}
+
+// Watchpoints returns the active watchpoints, in the order they were added.
+func (chip8 *CHIP8) Watchpoints() []Watchpoint {
+	return slices.Clone(chip8.watchpoints)
+}
+
+// ClearWatchpoint removes the watchpoint at index i of Watchpoints.
+func (chip8 *CHIP8) ClearWatchpoint(i int) {
+	if i >= 0 && i < len(chip8.watchpoints) {
+		chip8.watchpoints = slices.Delete(chip8.watchpoints, i, i+1)
+	}
+}
+
+// watchMemory records a hit if a watchpoint covers an access to addr.
+func (chip8 *CHIP8) watchMemory(addr int, value uint8, write bool) {
+	if chip8.watchHit != nil {
+		return
+	}
+
+	for _, wp := range chip8.watchpoints {
+		if wp.Target != WatchMemory || addr < wp.Start || addr > wp.End {
+			continue
+		}
+		if (write && !wp.Write) || (!write && !wp.Read) {
+			continue
+		}
+		if wp.Match && wp.Value != uint16(value) {
+			continue
+		}
+
+		chip8.watchHit = &WatchHit{Watchpoint: wp, PC: chip8.instPC, Address: addr, Write: write, Value: uint16(value)}
+		return
+	}
+}
+
+// watchRegisters records a hit if a watched register differs from before.
+func (chip8 *CHIP8) watchRegisters(v [16]uint8, i uint16) {
+	if chip8.watchHit != nil {
+		return
+	}
+
+	for _, wp := range chip8.watchpoints {
+		var value uint16
+		switch {
+		case wp.Target == WatchRegister && chip8.V[wp.Register&0xF] != v[wp.Register&0xF]:
+			value = uint16(chip8.V[wp.Register&0xF])
+		case wp.Target == WatchIndex && chip8.I != i:
+			value = chip8.I
+		default:
+			continue
+		}
+		if wp.Match && wp.Value != value {
+			continue
+		}
+
+		chip8.watchHit = &WatchHit{Watchpoint: wp, PC: chip8.instPC, Value: value}
+		return
+	}
+}
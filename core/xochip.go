@@ -0,0 +1,39 @@
+package core
+
+import "math"
+
+// skip jumps over the next instruction. On XO-CHIP the F000 NNNN long load
+// is four bytes wide and is skipped as a whole.
+func (chip8 *CHIP8) skip() {
+	if chip8.extension == XOCHIP && chip8.ram[chip8.PC] == 0xF0 && chip8.ram[chip8.PC+1] == 0x00 {
+		chip8.PC += 4
+	} else {
+		chip8.PC += 2
+	}
+}
+
+// registerRange lists the registers from VX to VY inclusive for 5XY2/5XY3,
+// counting down when X > Y.
+func (chip8 *CHIP8) registerRange() []uint8 {
+	x, y := chip8.inst.X, chip8.inst.Y
+	regs := make([]uint8, 0, 16)
+
+	if x <= y {
+		for reg := x; reg <= y; reg++ {
+			regs = append(regs, reg)
+		}
+	} else {
+		for reg := int(x); reg >= int(y); reg-- {
+			regs = append(regs, uint8(reg))
+		}
+	}
+
+	return regs
+}
+
+// AudioPattern returns the XO-CHIP sample buffer and its playback rate,
+// 4000 * 2^((pitch - 64) / 48) Hz.
+func (chip8 *CHIP8) AudioPattern() ([16]uint8, float64, bool) {
+	rate := 4000 * math.Pow(2, (float64(chip8.pitch)-64)/48)
+	return chip8.audioPattern, rate, chip8.hasPattern
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bufio"
+	"chip8-emulator/core"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const debuggerHelp = `Commands:
+  b ADDR     set a breakpoint on PC == ADDR (hex)
+  d ADDR     delete the breakpoint at ADDR
+  bl         list breakpoints
+  w ADDR[-END] [r|w|rw] [=VAL]
+             stop after an instruction reads or writes RAM in the range,
+             writes by default, optionally only when the byte equals VAL
+  wv X [=VAL]
+             stop after VX changes, optionally only to VAL
+  wi [=VAL]  stop after I changes, optionally only to VAL
+  wl         list watchpoints
+  wd N       delete watchpoint N from wl
+  s          single-step one instruction
+  n          step over: like s, but runs a 2NNN call until it returns
+  o          step out: run until 00EE returns from the current subroutine
+  c          continue until the next breakpoint
+  r          dump registers, stack, timers and keypad
+  h          show this help`
+
+// Debugger is a command console on stdin that pauses the main loop. Lines are
+// read on a separate goroutine so the window stays responsive while waiting.
+type Debugger struct {
+	chip8    *core.CHIP8
+	commands chan string
+	paused   bool
+}
+
+// Init starts reading commands and pauses in front of the first instruction.
+func (d *Debugger) Init(chip8 *core.CHIP8) {
+	d.chip8 = chip8
+	d.commands = make(chan string)
+	d.paused = true
+
+	go func() {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			d.commands <- scanner.Text()
+		}
+		close(d.commands)
+	}()
+
+	fmt.Println("==== DEBUGGER ====")
+	fmt.Println(debuggerHelp)
+	d.where()
+}
+
+// Paused reports whether the main loop should hold off running frames.
+func (d *Debugger) Paused() bool {
+	return d.paused
+}
+
+// Poll runs any commands typed since the last call without blocking.
+func (d *Debugger) Poll() {
+	for {
+		select {
+		case line, ok := <-d.commands:
+			if !ok {
+				// stdin closed, nothing can resume us any more
+				d.commands = nil
+				d.paused = false
+				return
+			}
+			d.run(line)
+		default:
+			return
+		}
+	}
+}
+
+// Stopped reports a break or fault returned by a frame and pauses.
+func (d *Debugger) Stopped(err error) {
+	var fault *core.Fault
+	var hit *core.WatchHit
+	switch {
+	case errors.As(err, &hit):
+		fmt.Println(hit)
+	case errors.Is(err, core.ErrBreak):
+		fmt.Println("break")
+	case errors.As(err, &fault):
+		fmt.Println("fault:", fault)
+	default:
+		return
+	}
+
+	d.paused = true
+	d.where()
+}
+
+func (d *Debugger) run(line string) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return
+	}
+
+	regs := d.chip8.Registers()
+
+	switch fields[0] {
+	case "b", "break":
+		if addr, ok := d.address(fields); ok {
+			d.chip8.SetBreakpoint(addr)
+			fmt.Printf("breakpoint at 0x%03X\n", addr)
+		}
+	case "d", "delete":
+		if addr, ok := d.address(fields); ok {
+			d.chip8.ClearBreakpoint(addr)
+		}
+	case "bl":
+		for _, addr := range d.chip8.Breakpoints() {
+			fmt.Printf("0x%03X\n", addr)
+		}
+	case "w", "wv", "wi":
+		if wp, ok := d.watchpoint(fields); ok {
+			d.chip8.AddWatchpoint(wp)
+			fmt.Println("watching", wp)
+		}
+	case "wl":
+		for i, wp := range d.chip8.Watchpoints() {
+			fmt.Printf("%d: %v\n", i, wp)
+		}
+	case "wd":
+		if len(fields) < 2 {
+			fmt.Println("missing watchpoint number")
+			return
+		}
+		if i, err := strconv.Atoi(fields[1]); err == nil {
+			d.chip8.ClearWatchpoint(i)
+		}
+	case "s", "step":
+		d.step()
+	case "n", "next":
+		if d.opcode(regs.PC)>>12 != 0x2 {
+			d.step()
+			return
+		}
+		returnPC, depth := regs.PC+2, regs.StackPointer
+		d.chip8.BreakWhen(func() bool {
+			regs := d.chip8.Registers()
+			return regs.PC == returnPC && regs.StackPointer == depth
+		})
+		d.cont()
+	case "o", "out":
+		if regs.StackPointer == 0 {
+			fmt.Println("not in a subroutine")
+			return
+		}
+		depth := regs.StackPointer
+		d.chip8.BreakWhen(func() bool {
+			return d.chip8.Registers().StackPointer < depth
+		})
+		d.cont()
+	case "c", "continue":
+		d.cont()
+	case "r", "regs":
+		d.dump()
+	case "h", "help":
+		fmt.Println(debuggerHelp)
+	default:
+		fmt.Printf("unknown command %q, h for help\n", fields[0])
+	}
+}
+
+// step executes a single instruction, ignoring breakpoints.
+func (d *Debugger) step() {
+	if d.chip8.State() != core.RUNNING {
+		fmt.Println("machine is not running")
+		return
+	}
+
+	if err := d.chip8.ExecuteInstruction(); err != nil {
+		d.Stopped(err)
+		return
+	}
+	d.where()
+}
+
+func (d *Debugger) cont() {
+	d.chip8.Resume()
+	d.paused = false
+}
+
+func (d *Debugger) address(fields []string) (uint16, bool) {
+	if len(fields) < 2 {
+		fmt.Println("missing address")
+		return 0, false
+	}
+
+	addr, err := strconv.ParseUint(strings.TrimPrefix(fields[1], "0x"), 16, 16)
+	if err != nil {
+		fmt.Printf("bad address %q\n", fields[1])
+		return 0, false
+	}
+
+	return uint16(addr), true
+}
+
+// watchpoint parses the arguments of the w, wv and wi commands.
+func (d *Debugger) watchpoint(fields []string) (core.Watchpoint, bool) {
+	var wp core.Watchpoint
+	args := fields[1:]
+
+	// A trailing =VAL restricts any kind of watchpoint to a value
+	if n := len(args); n > 0 && strings.HasPrefix(args[n-1], "=") {
+		value, err := strconv.ParseUint(strings.TrimPrefix(args[n-1][1:], "0x"), 16, 16)
+		if err != nil {
+			fmt.Printf("bad value %q\n", args[n-1])
+			return wp, false
+		}
+		wp.Match, wp.Value = true, uint16(value)
+		args = args[:n-1]
+	}
+
+	switch fields[0] {
+	case "wi":
+		wp.Target = core.WatchIndex
+	case "wv":
+		if len(args) < 1 {
+			fmt.Println("missing register")
+			return wp, false
+		}
+		reg, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(args[0]), "V"), 16, 4)
+		if err != nil {
+			fmt.Printf("bad register %q\n", args[0])
+			return wp, false
+		}
+		wp.Target, wp.Register = core.WatchRegister, uint8(reg)
+	default:
+		if len(args) < 1 {
+			fmt.Println("missing address")
+			return wp, false
+		}
+		start, end, _ := strings.Cut(args[0], "-")
+		if end == "" {
+			end = start
+		}
+		first, ok1 := d.address([]string{"", start})
+		last, ok2 := d.address([]string{"", end})
+		if !ok1 || !ok2 {
+			return wp, false
+		}
+		wp.Target, wp.Start, wp.End = core.WatchMemory, int(first), int(last)
+		wp.Write = true
+		if len(args) > 1 {
+			wp.Read, wp.Write = strings.Contains(args[1], "r"), strings.Contains(args[1], "w")
+		}
+	}
+
+	return wp, true
+}
+
+func (d *Debugger) opcode(addr uint16) uint16 {
+	memory := d.chip8.Memory()
+	if int(addr)+1 >= len(memory) {
+		return 0
+	}
+	return uint16(memory[addr])<<8 | uint16(memory[addr+1])
+}
+
+// where prints the next instruction.
+func (d *Debugger) where() {
+	pc := d.chip8.Registers().PC
+	fmt.Printf("PC 0x%03X: %04X\n", pc, d.opcode(pc))
+}
+
+func (d *Debugger) dump() {
+	regs := d.chip8.Registers()
+
+	for i, v := range regs.V {
+		fmt.Printf("V%X=%02X ", i, v)
+		if i == 7 {
+			fmt.Println()
+		}
+	}
+	fmt.Println()
+	fmt.Printf("I=%03X PC=%03X SP=%d\n", regs.I, regs.PC, regs.StackPointer)
+	fmt.Printf("Stack: % X\n", regs.Stack[:regs.StackPointer])
+	fmt.Printf("Delay timer: %d Sound timer: %d\n", regs.DelayTimer, regs.SoundTimer)
+
+	mask := d.chip8.KeypadMask()
+	fmt.Print("Keypad:")
+	for key := range 16 {
+		if mask&(1<<key) != 0 {
+			fmt.Printf(" %X", key)
+		}
+	}
+	fmt.Println()
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"chip8-emulator/core"
+	"os"
+)
+
+// Disasm prints an annotated listing of the configured ROM to stdout.
+func Disasm(config *Config) error {
+	rom, err := core.ReadRom(config.romName)
+	if err != nil {
+		return err
+	}
+
+	return core.Disassemble(os.Stdout, rom, core.EntryPoint, config.currentExtension, config.quirks)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/jupiterrider/purego-sdl3/sdl"
+)
+
+const (
+	glyphWidth  = 5
+	glyphHeight = 7
+	charWidth   = glyphWidth + 1  // Glyph plus spacing, in font pixels
+	lineHeight  = glyphHeight + 2 // Glyph plus spacing, in font pixels
+)
+
+// fontGlyphs is the built-in 5x7 font used by the debug overlay, one byte
+// per row with bit 4 leftmost. Lowercase letters draw as uppercase.
+var fontGlyphs = map[byte][glyphHeight]uint8{
+	' ': {},
+	'!': {0x04, 0x04, 0x04, 0x04, 0x04, 0x00, 0x04},
+	'#': {0x0A, 0x0A, 0x1F, 0x0A, 0x1F, 0x0A, 0x0A},
+	'%': {0x18, 0x19, 0x02, 0x04, 0x08, 0x13, 0x03},
+	'(': {0x02, 0x04, 0x08, 0x08, 0x08, 0x04, 0x02},
+	')': {0x08, 0x04, 0x02, 0x02, 0x02, 0x04, 0x08},
+	'*': {0x00, 0x04, 0x15, 0x0E, 0x15, 0x04, 0x00},
+	'+': {0x00, 0x04, 0x04, 0x1F, 0x04, 0x04, 0x00},
+	',': {0x00, 0x00, 0x00, 0x00, 0x0C, 0x04, 0x08},
+	'-': {0x00, 0x00, 0x00, 0x1F, 0x00, 0x00, 0x00},
+	'.': {0x00, 0x00, 0x00, 0x00, 0x00, 0x0C, 0x0C},
+	'/': {0x00, 0x01, 0x02, 0x04, 0x08, 0x10, 0x00},
+	'0': {0x0E, 0x11, 0x13, 0x15, 0x19, 0x11, 0x0E},
+	'1': {0x04, 0x0C, 0x04, 0x04, 0x04, 0x04, 0x0E},
+	'2': {0x0E, 0x11, 0x01, 0x02, 0x04, 0x08, 0x1F},
+	'3': {0x1F, 0x02, 0x04, 0x02, 0x01, 0x11, 0x0E},
+	'4': {0x02, 0x06, 0x0A, 0x12, 0x1F, 0x02, 0x02},
+	'5': {0x1F, 0x10, 0x1E, 0x01, 0x01, 0x11, 0x0E},
+	'6': {0x06, 0x08, 0x10, 0x1E, 0x11, 0x11, 0x0E},
+	'7': {0x1F, 0x01, 0x02, 0x04, 0x08, 0x08, 0x08},
+	'8': {0x0E, 0x11, 0x11, 0x0E, 0x11, 0x11, 0x0E},
+	'9': {0x0E, 0x11, 0x11, 0x0F, 0x01, 0x02, 0x0C},
+	':': {0x00, 0x0C, 0x0C, 0x00, 0x0C, 0x0C, 0x00},
+	';': {0x00, 0x0C, 0x0C, 0x00, 0x0C, 0x04, 0x08},
+	'<': {0x02, 0x04, 0x08, 0x10, 0x08, 0x04, 0x02},
+	'=': {0x00, 0x00, 0x1F, 0x00, 0x1F, 0x00, 0x00},
+	'>': {0x08, 0x04, 0x02, 0x01, 0x02, 0x04, 0x08},
+	'?': {0x0E, 0x11, 0x01, 0x02, 0x04, 0x00, 0x04},
+	'A': {0x0E, 0x11, 0x11, 0x1F, 0x11, 0x11, 0x11},
+	'B': {0x1E, 0x11, 0x11, 0x1E, 0x11, 0x11, 0x1E},
+	'C': {0x0E, 0x11, 0x10, 0x10, 0x10, 0x11, 0x0E},
+	'D': {0x1C, 0x12, 0x11, 0x11, 0x11, 0x12, 0x1C},
+	'E': {0x1F, 0x10, 0x10, 0x1E, 0x10, 0x10, 0x1F},
+	'F': {0x1F, 0x10, 0x10, 0x1E, 0x10, 0x10, 0x10},
+	'G': {0x0E, 0x11, 0x10, 0x17, 0x11, 0x11, 0x0F},
+	'H': {0x11, 0x11, 0x11, 0x1F, 0x11, 0x11, 0x11},
+	'I': {0x0E, 0x04, 0x04, 0x04, 0x04, 0x04, 0x0E},
+	'J': {0x07, 0x02, 0x02, 0x02, 0x02, 0x12, 0x0C},
+	'K': {0x11, 0x12, 0x14, 0x18, 0x14, 0x12, 0x11},
+	'L': {0x10, 0x10, 0x10, 0x10, 0x10, 0x10, 0x1F},
+	'M': {0x11, 0x1B, 0x15, 0x15, 0x11, 0x11, 0x11},
+	'N': {0x11, 0x11, 0x19, 0x15, 0x13, 0x11, 0x11},
+	'O': {0x0E, 0x11, 0x11, 0x11, 0x11, 0x11, 0x0E},
+	'P': {0x1E, 0x11, 0x11, 0x1E, 0x10, 0x10, 0x10},
+	'Q': {0x0E, 0x11, 0x11, 0x11, 0x15, 0x12, 0x0D},
+	'R': {0x1E, 0x11, 0x11, 0x1E, 0x14, 0x12, 0x11},
+	'S': {0x0F, 0x10, 0x10, 0x0E, 0x01, 0x01, 0x1E},
+	'T': {0x1F, 0x04, 0x04, 0x04, 0x04, 0x04, 0x04},
+	'U': {0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x0E},
+	'V': {0x11, 0x11, 0x11, 0x11, 0x11, 0x0A, 0x04},
+	'W': {0x11, 0x11, 0x11, 0x15, 0x15, 0x15, 0x0A},
+	'X': {0x11, 0x11, 0x0A, 0x04, 0x0A, 0x11, 0x11},
+	'Y': {0x11, 0x11, 0x11, 0x0A, 0x04, 0x04, 0x04},
+	'Z': {0x1F, 0x01, 0x02, 0x04, 0x08, 0x10, 0x1F},
+	'[': {0x0E, 0x08, 0x08, 0x08, 0x08, 0x08, 0x0E},
+	']': {0x0E, 0x02, 0x02, 0x02, 0x02, 0x02, 0x0E},
+	'_': {0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x1F},
+	'|': {0x04, 0x04, 0x04, 0x04, 0x04, 0x04, 0x04},
+}
+
+// DrawText draws text at x, y in color (RGBA) with the built-in font, each
+// font pixel size screen pixels square. Characters without a glyph draw as '?'.
+func DrawText(renderer *sdl.Renderer, x, y, size float32, text string, color uint32) {
+	var rects []sdl.FRect
+
+	for i := range len(text) {
+		glyph, ok := fontGlyphs[strings.ToUpper(text[i : i+1])[0]]
+		if !ok {
+			glyph = fontGlyphs['?']
+		}
+
+		left := x + float32(i*charWidth)*size
+		for row, bits := range glyph {
+			for col := range glyphWidth {
+				if bits&(0x10>>col) != 0 {
+					rects = append(rects, sdl.FRect{X: left + float32(col)*size, Y: y + float32(row)*size, W: size, H: size})
+				}
+			}
+		}
+	}
+
+	if len(rects) > 0 {
+		setDrawColor(renderer, color)
+		sdl.RenderFillRects(renderer, rects)
+	}
+}
+
+// setDrawColor sets the draw color from an RGBA value.
+func setDrawColor(renderer *sdl.Renderer, color uint32) {
+	sdl.SetRenderDrawColor(renderer, uint8(color>>24), uint8(color>>16), uint8(color>>8), uint8(color))
+}
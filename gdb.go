@@ -0,0 +1,420 @@
+package main
+
+import (
+	"bufio"
+	"chip8-emulator/core"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// GDB register numbers: V0-VF, then I, PC, SP and the two timers.
+const (
+	gdbRegI  = 16
+	gdbRegPC = 17
+	gdbRegSP = 18
+	gdbRegDT = 19
+	gdbRegST = 20
+)
+
+// gdbRegisterSizes is the size in bytes of each register in g packets.
+var gdbRegisterSizes = [...]int{1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 2, 2, 1, 1, 1}
+
+// gdbEvent is a packet, interrupt or connection change read from a client.
+type gdbEvent struct {
+	conn   net.Conn
+	packet string
+	kind   gdbEventKind
+}
+
+type gdbEventKind uint8
+
+const (
+	gdbPacket gdbEventKind = iota
+	gdbInterrupt
+	gdbAttach
+	gdbDetach
+)
+
+// GdbServer serves the GDB remote serial protocol on a TCP port. Packets are
+// read on background goroutines but only ever handled from Poll, so the
+// machine is never touched outside the main loop.
+type GdbServer struct {
+	chip8   *core.CHIP8
+	events  chan gdbEvent
+	conn    net.Conn // Current client, nil when detached
+	halted  bool
+	running bool // A client is waiting for the reply to c or s
+}
+
+// Init starts listening on addr. The machine stays halted until a client
+// connects and continues it.
+func (g *GdbServer) Init(chip8 *core.CHIP8, addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to start gdb server: %w", err)
+	}
+
+	g.chip8 = chip8
+	g.events = make(chan gdbEvent, 16)
+	g.halted = true
+
+	go g.accept(listener)
+	println("==== WAITING FOR GDB ON", listener.Addr().String(), "====")
+
+	return nil
+}
+
+func (g *GdbServer) accept(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		g.events <- gdbEvent{conn: conn, kind: gdbAttach}
+		g.read(conn)
+		g.events <- gdbEvent{conn: conn, kind: gdbDetach}
+		conn.Close()
+	}
+}
+
+// read forwards the packets of one client until it disconnects.
+func (g *GdbServer) read(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return
+		}
+
+		switch b {
+		case 0x03:
+			g.events <- gdbEvent{conn: conn, kind: gdbInterrupt}
+		case '$':
+			data, err := r.ReadString('#')
+			if err != nil {
+				return
+			}
+			if _, err := r.Discard(2); err != nil { // checksum, TCP is reliable enough
+				return
+			}
+			if _, err := conn.Write([]byte{'+'}); err != nil {
+				return
+			}
+			g.events <- gdbEvent{conn: conn, packet: strings.TrimSuffix(data, "#")}
+		}
+		// Acks and anything between packets are ignored
+	}
+}
+
+// Halted reports whether the main loop should hold off running frames.
+func (g *GdbServer) Halted() bool {
+	return g.halted
+}
+
+// Poll handles everything received since the last call without blocking.
+func (g *GdbServer) Poll() {
+	for {
+		select {
+		case event := <-g.events:
+			g.handle(event)
+		default:
+			return
+		}
+	}
+}
+
+// Stopped reports a break or fault returned by a frame to the client.
+func (g *GdbServer) Stopped(err error) {
+	if !g.running {
+		return
+	}
+
+	var fault *core.Fault
+	switch {
+	case errors.Is(err, core.ErrBreak):
+		g.stop("S05") // SIGTRAP
+	case errors.As(err, &fault) && errors.Is(fault, core.ErrIllegalOpcode):
+		g.stop("S04") // SIGILL
+	case errors.As(err, &fault) && errors.Is(fault, core.ErrMemoryOutOfBounds):
+		g.stop("S0b") // SIGSEGV
+	case errors.As(err, &fault):
+		g.stop("S06") // SIGABRT for stack faults
+	}
+}
+
+func (g *GdbServer) stop(reply string) {
+	g.halted = true
+	g.running = false
+	g.send(reply)
+}
+
+func (g *GdbServer) send(payload string) {
+	if g.conn == nil {
+		return
+	}
+
+	var sum uint8
+	for i := 0; i < len(payload); i++ {
+		sum += payload[i]
+	}
+	fmt.Fprintf(g.conn, "$%s#%02x", payload, sum)
+}
+
+func (g *GdbServer) handle(event gdbEvent) {
+	switch event.kind {
+	case gdbAttach:
+		if g.conn != nil {
+			// One client at a time
+			event.conn.Close()
+			return
+		}
+		g.conn = event.conn
+		g.halted = true
+		g.running = false
+		return
+	case gdbDetach:
+		if event.conn == g.conn {
+			g.conn = nil
+			g.halted = false
+			g.running = false
+		}
+		return
+	case gdbInterrupt:
+		if event.conn == g.conn && g.running {
+			g.stop("S02") // SIGINT
+		}
+		return
+	}
+
+	if event.conn != g.conn {
+		return
+	}
+
+	if reply, ok := g.command(event.packet); ok {
+		g.send(reply)
+	}
+}
+
+// command runs one packet and returns its reply. ok is false when the reply
+// is sent later, as for continue.
+func (g *GdbServer) command(packet string) (reply string, ok bool) {
+	if packet == "" {
+		return "", true
+	}
+	args := packet[1:]
+
+	switch packet[0] {
+	case '?':
+		return "S05", true
+	case 'g':
+		return hex.EncodeToString(g.registerBytes()), true
+	case 'G':
+		data, err := hex.DecodeString(args)
+		if err != nil || len(data) != len(g.registerBytes()) {
+			return "E01", true
+		}
+		g.setRegisterBytes(data)
+		return "OK", true
+	case 'p':
+		n, err := strconv.ParseUint(args, 16, 8)
+		if err != nil || int(n) >= len(gdbRegisterSizes) {
+			return "E01", true
+		}
+		offset := g.registerOffset(int(n))
+		return hex.EncodeToString(g.registerBytes()[offset : offset+gdbRegisterSizes[n]]), true
+	case 'P':
+		reg, value, _ := strings.Cut(args, "=")
+		n, err := strconv.ParseUint(reg, 16, 8)
+		data, err2 := hex.DecodeString(value)
+		if err != nil || err2 != nil || int(n) >= len(gdbRegisterSizes) || len(data) != gdbRegisterSizes[n] {
+			return "E01", true
+		}
+		regs := g.registerBytes()
+		copy(regs[g.registerOffset(int(n)):], data)
+		g.setRegisterBytes(regs)
+		return "OK", true
+	case 'm':
+		addr, length, ok := parseGdbRange(args)
+		memory := g.chip8.Memory()
+		if !ok || addr+length > len(memory) {
+			return "E01", true
+		}
+		return hex.EncodeToString(memory[addr : addr+length]), true
+	case 'M':
+		rng, value, _ := strings.Cut(args, ":")
+		addr, length, ok := parseGdbRange(rng)
+		data, err := hex.DecodeString(value)
+		if !ok || err != nil || len(data) != length || g.chip8.WriteMemory(addr, data) != nil {
+			return "E01", true
+		}
+		return "OK", true
+	case 'Z', 'z':
+		return g.breakpoint(packet[0] == 'Z', args), true
+	case 's':
+		g.running = true
+		if fault := g.chip8.Fault(); fault != nil {
+			g.Stopped(fault)
+		} else if err := g.chip8.ExecuteInstruction(); err != nil {
+			g.Stopped(err)
+		} else {
+			g.stop("S05")
+		}
+		return "", false
+	case 'c':
+		g.running = true
+		// A faulted machine can't run, so report the fault again
+		if fault := g.chip8.Fault(); fault != nil {
+			g.Stopped(fault)
+			return "", false
+		}
+		g.chip8.Resume()
+		g.halted = false
+		return "", false
+	case 'D':
+		g.halted = false
+		g.running = false
+		g.send("OK")
+		g.conn.Close()
+		g.conn = nil
+		return "", false
+	case 'k':
+		g.chip8.SetState(core.QUIT)
+		return "", false
+	case 'H':
+		return "OK", true
+	case 'q':
+		return g.query(args), true
+	}
+
+	// Unsupported packets get an empty reply
+	return "", true
+}
+
+func (g *GdbServer) query(args string) string {
+	switch {
+	case strings.HasPrefix(args, "Supported"):
+		return "PacketSize=4000;qXfer:features:read+"
+	case args == "Attached":
+		return "1"
+	case args == "C":
+		return "QC1"
+	case strings.HasPrefix(args, "Xfer:features:read:target.xml:"):
+		offset, length, ok := parseGdbRange(strings.TrimPrefix(args, "Xfer:features:read:target.xml:"))
+		if !ok {
+			return "E01"
+		}
+		xml := gdbTargetXML()
+		if offset >= len(xml) {
+			return "l"
+		}
+		if end := offset + length; end < len(xml) {
+			return "m" + xml[offset:end]
+		}
+		return "l" + xml[offset:]
+	}
+	return ""
+}
+
+// breakpoint handles Z and z packets. Types 0 and 1 are breakpoints, 2, 3
+// and 4 are write, read and access watchpoints.
+func (g *GdbServer) breakpoint(insert bool, args string) string {
+	parts := strings.Split(args, ",")
+	if len(parts) < 3 {
+		return "E01"
+	}
+	addr, length, ok := parseGdbRange(parts[1] + "," + parts[2])
+	if !ok {
+		return "E01"
+	}
+
+	switch parts[0] {
+	case "0", "1":
+		if insert {
+			g.chip8.SetBreakpoint(uint16(addr))
+		} else {
+			g.chip8.ClearBreakpoint(uint16(addr))
+		}
+		return "OK"
+	case "2", "3", "4":
+		wp := core.Watchpoint{
+			Target: core.WatchMemory,
+			Start:  addr,
+			End:    addr + max(length, 1) - 1,
+			Read:   parts[0] != "2",
+			Write:  parts[0] != "3",
+		}
+		if insert {
+			g.chip8.AddWatchpoint(wp)
+			return "OK"
+		}
+		for i, existing := range g.chip8.Watchpoints() {
+			if existing == wp {
+				g.chip8.ClearWatchpoint(i)
+				break
+			}
+		}
+		return "OK"
+	}
+
+	return ""
+}
+
+// registerBytes encodes the registers in g packet order, little endian.
+func (g *GdbServer) registerBytes() []uint8 {
+	regs := g.chip8.Registers()
+	data := append([]uint8{}, regs.V[:]...)
+	data = binary.LittleEndian.AppendUint16(data, regs.I)
+	data = binary.LittleEndian.AppendUint16(data, regs.PC)
+	return append(data, regs.StackPointer, regs.DelayTimer, regs.SoundTimer)
+}
+
+func (g *GdbServer) setRegisterBytes(data []uint8) {
+	regs := g.chip8.Registers()
+	copy(regs.V[:], data)
+	regs.I = binary.LittleEndian.Uint16(data[g.registerOffset(gdbRegI):])
+	regs.PC = binary.LittleEndian.Uint16(data[g.registerOffset(gdbRegPC):])
+	regs.StackPointer = data[g.registerOffset(gdbRegSP)]
+	regs.DelayTimer = data[g.registerOffset(gdbRegDT)]
+	regs.SoundTimer = data[g.registerOffset(gdbRegST)]
+	g.chip8.SetRegisters(regs)
+}
+
+func (g *GdbServer) registerOffset(n int) int {
+	offset := 0
+	for _, size := range gdbRegisterSizes[:n] {
+		offset += size
+	}
+	return offset
+}
+
+// parseGdbRange parses the hex "addr,length" used by m, M, Z and qXfer.
+func parseGdbRange(s string) (addr, length int, ok bool) {
+	a, l, found := strings.Cut(s, ",")
+	addr64, err1 := strconv.ParseUint(a, 16, 32)
+	length64, err2 := strconv.ParseUint(l, 16, 32)
+	if !found || err1 != nil || err2 != nil {
+		return 0, 0, false
+	}
+	return int(addr64), int(length64), true
+}
+
+// gdbTargetXML describes the register layout to the client.
+func gdbTargetXML() string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0"?><!DOCTYPE target SYSTEM "gdb-target.dtd"><target version="1.0"><feature name="org.chip8.cpu">`)
+	for i := range 16 {
+		fmt.Fprintf(&b, `<reg name="v%x" bitsize="8" type="uint8" regnum="%d"/>`, i, i)
+	}
+	fmt.Fprintf(&b, `<reg name="i" bitsize="16" type="data_ptr" regnum="%d"/>`, gdbRegI)
+	fmt.Fprintf(&b, `<reg name="pc" bitsize="16" type="code_ptr" regnum="%d"/>`, gdbRegPC)
+	fmt.Fprintf(&b, `<reg name="sp" bitsize="8" type="uint8" regnum="%d"/>`, gdbRegSP)
+	fmt.Fprintf(&b, `<reg name="dt" bitsize="8" type="uint8" regnum="%d"/>`, gdbRegDT)
+	fmt.Fprintf(&b, `<reg name="st" bitsize="8" type="uint8" regnum="%d"/>`, gdbRegST)
+	b.WriteString(`</feature></target>`)
+	return b.String()
+}
@@ -1,17 +1,37 @@
 package main
 
-import "github.com/jupiterrider/purego-sdl3/sdl"
+import (
+	"chip8-emulator/core"
+	"fmt"
+
+	"github.com/jupiterrider/purego-sdl3/sdl"
+)
 
 type Keyboard struct {
-	chip8  *CHIP8
-	config *Config
-	sdl_t  sdl_t
+	chip8     *core.CHIP8
+	config    *Config
+	sdl_t     sdl_t
+	rewinding bool // Rewind key is held
+	movie     *MovieControl
+	overlay   *Overlay
+	romKeymap map[sdl.Scancode]byte // Extra keys bound by the ROM database
 }
 
-func (k *Keyboard) Init(chip8 *CHIP8, config *Config, sdl_t sdl_t) {
+func (k *Keyboard) Init(chip8 *core.CHIP8, config *Config, sdl_t sdl_t, movie *MovieControl, overlay *Overlay) {
 	k.chip8 = chip8
 	k.config = config
 	k.sdl_t = sdl_t
+	k.movie = movie
+	k.overlay = overlay
+
+	k.romKeymap = map[sdl.Scancode]byte{}
+	if config.romInfo != nil {
+		for control, key := range config.romInfo.Keys {
+			if scancode, ok := romControls[control]; ok {
+				k.romKeymap[scancode] = key & 0xF
+			}
+		}
+	}
 }
 
 // CHIP8 Keypad  QWERTY
@@ -41,6 +61,17 @@ var keymap = map[sdl.Scancode]byte{
 	sdl.ScancodeV: 0xF,
 }
 
+// romControls are the host keys for the named controls a ROM database entry
+// can bind to keypad keys, on top of keymap.
+var romControls = map[string]sdl.Scancode{
+	"up":    sdl.ScancodeUp,
+	"down":  sdl.ScancodeDown,
+	"left":  sdl.ScancodeLeft,
+	"right": sdl.ScancodeRight,
+	"a":     sdl.ScancodeReturn,
+	"b":     sdl.ScancodeRShift,
+}
+
 func (k *Keyboard) HandleInput() {
 	var event sdl.Event
 
@@ -48,7 +79,7 @@ func (k *Keyboard) HandleInput() {
 		switch event.Type() {
 		case sdl.EventQuit:
 			// Exit window; End program
-			k.chip8.state = QUIT
+			k.chip8.SetState(core.QUIT)
 			return
 		case sdl.EventKeyDown:
 			k.OnKeyDown(event)
@@ -62,21 +93,45 @@ func (k *Keyboard) OnKeyDown(event sdl.Event) {
 	switch event.Key().Scancode {
 	case sdl.ScancodeEscape:
 		// Escape key; Exit window & End program
-		k.chip8.state = QUIT
+		k.chip8.SetState(core.QUIT)
 	case sdl.ScancodeSpace:
 		// Space bar
-		if k.chip8.state == RUNNING {
-			k.chip8.state = PAUSED
+		if k.chip8.State() == core.FAULTED {
+			// Only reloading the ROM recovers from a fault
+			break
+		}
+
+		if k.chip8.State() == core.RUNNING {
+			k.chip8.SetState(core.PAUSED)
 			println("==== PAUSED ====")
 		} else {
-			k.chip8.state = RUNNING
+			k.chip8.SetState(core.RUNNING)
 			println("==== RESUMED ====")
 		}
 	case sdl.ScancodeR:
 		// 'r': Reset CHIP8 machine for the current ROM
+		if k.movie.Active() {
+			// A reset the movie didn't record would break its replay
+			println("==== CAN'T RELOAD DURING A MOVIE ====")
+			break
+		}
 		println("==== RELOADING ROM ====")
 		k.chip8.Reset()
-		k.chip8.Init(k.chip8.romName, k.config, k.sdl_t)
+		sdl.SetWindowTitle(k.sdl_t.window, windowTitle)
+	case sdl.ScancodeF1, sdl.ScancodeF2, sdl.ScancodeF3, sdl.ScancodeF4:
+		// F1-F4: Load savestate slot 1-4, Shift+F1-F4: Save to slot 1-4
+		slot := int(event.Key().Scancode-sdl.ScancodeF1) + 1
+		if event.Key().Mod&sdl.KeymodShift != 0 {
+			k.SaveSlot(slot)
+		} else if k.movie.Active() {
+			// Like a reset, loading a state would break the movie's replay
+			println("==== CAN'T LOAD A SAVESTATE DURING A MOVIE ====")
+		} else {
+			k.LoadSlot(slot)
+		}
+	case sdl.ScancodeBackspace:
+		// Backspace: Hold to rewind
+		k.rewinding = true
 	case sdl.ScancodeO:
 		// 'o': Decrease Volume
 		if k.config.volume > 0 {
@@ -98,15 +153,62 @@ func (k *Keyboard) OnKeyDown(event sdl.Event) {
 		if k.config.colorLerpRate < 1.0 {
 			k.config.colorLerpRate += 0.1
 		}
-	default:
-		if chip8Key, ok := keymap[event.Key().Scancode]; ok {
-			k.chip8.keypad[chip8Key] = true
+	case sdl.ScancodeTab:
+		// Tab: Toggle the debug overlay
+		k.overlay.Toggle()
+	case sdl.ScancodeUp, sdl.ScancodeDown, sdl.ScancodePageUp, sdl.ScancodePageDown, sdl.ScancodeHome, sdl.ScancodeM:
+		// Arrows, Page Up/Down, Home: Scroll the overlay memory view, 'm': Switch it between hex and code.
+		// With the overlay hidden the arrows may be bound to the keypad by the ROM database.
+		if k.overlay.Enabled() {
+			k.overlay.OnKeyDown(event.Key().Scancode)
+		} else {
+			k.SetKey(event.Key().Scancode, true)
 		}
+	default:
+		k.SetKey(event.Key().Scancode, true)
 	}
 }
 
+// SetKey presses or releases the keypad key mapped to scancode, if any.
+func (k *Keyboard) SetKey(scancode sdl.Scancode, pressed bool) {
+	// Keypad input comes from the movie during playback
+	if k.movie.Playing() {
+		return
+	}
+
+	if chip8Key, ok := keymap[scancode]; ok {
+		k.chip8.SetKey(chip8Key, pressed)
+	} else if chip8Key, ok := k.romKeymap[scancode]; ok {
+		k.chip8.SetKey(chip8Key, pressed)
+	}
+}
+
+// SlotPath is the savestate file for a quick-save slot, stored next to the ROM.
+func (k *Keyboard) SlotPath(slot int) string {
+	return fmt.Sprintf("%s.slot%d.state", k.chip8.RomName(), slot)
+}
+
+func (k *Keyboard) SaveSlot(slot int) {
+	if err := k.chip8.SaveStateFile(k.SlotPath(slot)); err != nil {
+		sdl.Log("%v", err)
+		return
+	}
+	println("==== SAVED SLOT", slot, "====")
+}
+
+func (k *Keyboard) LoadSlot(slot int) {
+	if err := k.chip8.LoadStateFile(k.SlotPath(slot)); err != nil {
+		sdl.Log("%v", err)
+		return
+	}
+	sdl.SetWindowTitle(k.sdl_t.window, windowTitle)
+	println("==== LOADED SLOT", slot, "====")
+}
+
 func (k *Keyboard) OnKeyUp(event sdl.Event) {
-	if chip8Key, ok := keymap[event.Key().Scancode]; ok {
-		k.chip8.keypad[chip8Key] = false
+	if event.Key().Scancode == sdl.ScancodeBackspace {
+		k.rewinding = false
 	}
+
+	k.SetKey(event.Key().Scancode, false)
 }
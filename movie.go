@@ -0,0 +1,102 @@
+package main
+
+import (
+	"chip8-emulator/core"
+	"fmt"
+)
+
+// MovieControl records the keypad into a movie file, or replays one into the
+// keypad, one frame at a time from the main loop.
+type MovieControl struct {
+	movie     *core.Movie
+	path      string
+	recording bool
+	playing   bool
+	frame     int
+}
+
+// StartRecording records from the machine's current, freshly reset state.
+func (mc *MovieControl) StartRecording(chip8 *core.CHIP8, config *Config, path string) {
+	mc.movie = core.NewMovie(chip8, config.vipTiming, config.instsPerSecond/60)
+	mc.path = path
+	mc.recording = true
+	println("==== RECORDING MOVIE ====")
+}
+
+// StartPlayback loads the movie at path and restarts the machine with the
+// platform, quirks, seed and speed it was recorded with.
+func (mc *MovieControl) StartPlayback(chip8 *core.CHIP8, config *Config, path string) error {
+	movie, err := core.LoadMovie(path)
+	if err != nil {
+		return err
+	}
+
+	if movie.RomHash != chip8.RomHash() {
+		return fmt.Errorf("movie %s was recorded with a different ROM", path)
+	}
+
+	chip8.SetSeed(movie.Seed)
+	if movie.VIPRandom {
+		chip8.SetRandom(core.NewVIPRandom(chip8))
+	} else {
+		chip8.SetRandom(core.NewPCGRandom(movie.Seed))
+	}
+
+	if err := chip8.Init(chip8.RomName(), movie.Extension, movie.Quirks); err != nil {
+		return err
+	}
+
+	config.currentExtension = movie.Extension
+	config.quirks = movie.Quirks
+	config.vipTiming = movie.VIPTiming
+	config.seed = movie.Seed
+	config.vipRandom = movie.VIPRandom
+	config.instsPerSecond = movie.InstsPerFrame * 60
+
+	mc.movie = movie
+	mc.path = path
+	mc.playing = true
+	mc.frame = 0
+	println("==== PLAYING MOVIE ====")
+
+	return nil
+}
+
+// Active reports whether a movie is being recorded or played.
+func (mc *MovieControl) Active() bool {
+	return mc.recording || mc.playing
+}
+
+// Playing reports whether keypad input comes from the movie.
+func (mc *MovieControl) Playing() bool {
+	return mc.playing
+}
+
+// BeforeFrame records the keypad state for, or feeds the recorded keypad
+// state into, the frame about to run.
+func (mc *MovieControl) BeforeFrame(chip8 *core.CHIP8) {
+	switch {
+	case mc.recording:
+		mc.movie.Record(chip8)
+	case mc.playing:
+		if !mc.movie.Apply(chip8, mc.frame) {
+			mc.playing = false
+			chip8.SetKeypadMask(0)
+			println("==== MOVIE FINISHED ====")
+			return
+		}
+		mc.frame++
+	}
+}
+
+// Stop ends recording or playback, writing the movie file when recording.
+func (mc *MovieControl) Stop() error {
+	mc.playing = false
+
+	if !mc.recording {
+		return nil
+	}
+	mc.recording = false
+
+	return mc.movie.Save(mc.path)
+}
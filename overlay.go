@@ -0,0 +1,246 @@
+package main
+
+import (
+	"chip8-emulator/core"
+	"fmt"
+	"slices"
+
+	"github.com/jupiterrider/purego-sdl3/sdl"
+)
+
+const (
+	overlayTextSize   = 2  // Screen pixels per font pixel
+	overlayPadding    = 8  // Panel margin in screen pixels
+	overlayPanelChars = 22 // Width of the register panel in characters
+	overlayPanelLines = 28 // Height of the register panel in lines
+	overlayMemLines   = 16 // Lines in the memory view
+	overlayMemBefore  = 5  // Memory view lines shown before PC
+	overlayHexBytes   = 8  // Bytes per memory view line in hex mode
+
+	overlayBgColor     = 0x181818FF
+	overlayTextColor   = 0xC0C0C0FF
+	overlayDimColor    = 0x606060FF
+	overlayTitleColor  = 0x8FBF8FFF
+	overlayPCColor     = 0xFFCC00FF
+	overlayIndexColor  = 0x66CCFFFF
+	overlayFaultColor  = 0xFF4040FF
+	overlayCursorColor = 0x383020FF
+)
+
+// Overlay is the in-window debug layout. When enabled the window is widened
+// and the display shares it with panels for the registers, stack, timers and
+// keypad, and a hex or disassembly view of memory around PC.
+type Overlay struct {
+	chip8   *core.CHIP8
+	config  *Config
+	sdl_t   sdl_t
+	enabled bool
+	hex     bool // Memory view shows raw bytes instead of instructions
+	scroll  int  // Memory view offset from PC, in lines
+}
+
+func (o *Overlay) Init(chip8 *core.CHIP8, config *Config, sdl_t sdl_t) {
+	o.chip8 = chip8
+	o.config = config
+	o.sdl_t = sdl_t
+}
+
+func (o *Overlay) Enabled() bool {
+	return o.enabled
+}
+
+// displaySize is the size of the emulated display in screen pixels.
+func (o *Overlay) displaySize() (int32, int32) {
+	return o.config.window_width * int32(o.config.scale), o.config.window_height * int32(o.config.scale)
+}
+
+// Toggle shows or hides the overlay, resizing the window to fit.
+func (o *Overlay) Toggle() {
+	o.enabled = !o.enabled
+	o.scroll = 0
+
+	width, height := o.displaySize()
+	if o.enabled {
+		width += overlayPanelChars*charWidth*overlayTextSize + 2*overlayPadding
+		height = max(height+(overlayMemLines+1)*lineHeight*overlayTextSize+2*overlayPadding,
+			overlayPanelLines*lineHeight*overlayTextSize+2*overlayPadding)
+	}
+	sdl.SetWindowSize(o.sdl_t.window, width, height)
+}
+
+// OnKeyDown scrolls the memory view with the arrow keys, Page Up/Down and
+// Home, and switches between hex and disassembly with 'm'.
+func (o *Overlay) OnKeyDown(scancode sdl.Scancode) {
+	if !o.enabled {
+		return
+	}
+
+	switch scancode {
+	case sdl.ScancodeUp:
+		o.scroll--
+	case sdl.ScancodeDown:
+		o.scroll++
+	case sdl.ScancodePageUp:
+		o.scroll -= overlayMemLines
+	case sdl.ScancodePageDown:
+		o.scroll += overlayMemLines
+	case sdl.ScancodeHome:
+		o.scroll = 0
+	case sdl.ScancodeM:
+		o.hex = !o.hex
+		o.scroll = 0
+	}
+}
+
+// text draws s at character column col and line row of the panel at x, y.
+func (o *Overlay) text(x, y float32, col, row int, s string, color uint32) {
+	DrawText(o.sdl_t.renderer, x+float32(col*charWidth*overlayTextSize), y+float32(row*lineHeight*overlayTextSize), overlayTextSize, s, color)
+}
+
+// highlight fills the background of n characters at col, row.
+func (o *Overlay) highlight(x, y float32, col, row, n int, color uint32) {
+	renderer := o.sdl_t.renderer
+	rect := sdl.FRect{
+		X: x + float32(col*charWidth*overlayTextSize) - overlayTextSize,
+		Y: y + float32(row*lineHeight*overlayTextSize) - overlayTextSize,
+		W: float32(n*charWidth*overlayTextSize) + overlayTextSize,
+		H: float32(lineHeight * overlayTextSize),
+	}
+	setDrawColor(renderer, color)
+	sdl.RenderFillRect(renderer, &rect)
+}
+
+// Render draws the panels around the display.
+func (o *Overlay) Render() {
+	renderer := o.sdl_t.renderer
+	displayWidth, displayHeight := o.displaySize()
+
+	var windowWidth, windowHeight int32
+	sdl.GetWindowSize(o.sdl_t.window, &windowWidth, &windowHeight)
+
+	setDrawColor(renderer, overlayBgColor)
+	sdl.RenderFillRect(renderer, &sdl.FRect{X: float32(displayWidth), Y: 0, W: float32(windowWidth - displayWidth), H: float32(windowHeight)})
+	sdl.RenderFillRect(renderer, &sdl.FRect{X: 0, Y: float32(displayHeight), W: float32(displayWidth), H: float32(windowHeight - displayHeight)})
+
+	o.renderRegisters(float32(displayWidth+overlayPadding), overlayPadding)
+	o.renderMemory(overlayPadding, float32(displayHeight+overlayPadding))
+}
+
+// renderRegisters draws the machine state, registers, stack and keypad.
+func (o *Overlay) renderRegisters(x, y float32) {
+	chip8 := o.chip8
+	regs := chip8.Registers()
+
+	switch chip8.State() {
+	case core.RUNNING:
+		o.text(x, y, 0, 0, "RUNNING", overlayTitleColor)
+	case core.PAUSED:
+		o.text(x, y, 0, 0, "PAUSED", overlayPCColor)
+	case core.FAULTED:
+		o.text(x, y, 0, 0, "FAULTED", overlayFaultColor)
+	}
+
+	o.text(x, y, 0, 2, fmt.Sprintf("PC %04X", regs.PC), overlayPCColor)
+	o.text(x, y, 9, 2, fmt.Sprintf("I %04X", regs.I), overlayIndexColor)
+
+	for i := range 8 {
+		o.text(x, y, 0, 3+i, fmt.Sprintf("V%X %02X", i, regs.V[i]), overlayTextColor)
+		o.text(x, y, 9, 3+i, fmt.Sprintf("V%X %02X", i+8, regs.V[i+8]), overlayTextColor)
+	}
+
+	o.text(x, y, 0, 11, fmt.Sprintf("DT %02X", regs.DelayTimer), overlayTextColor)
+	o.text(x, y, 9, 11, fmt.Sprintf("ST %02X", regs.SoundTimer), overlayTextColor)
+
+	// Stack slots in two columns, unused slots dimmed
+	o.text(x, y, 0, 13, "STACK", overlayTitleColor)
+	o.text(x, y, 9, 13, fmt.Sprintf("SP %d", regs.StackPointer), overlayTextColor)
+	for i := range len(regs.Stack) {
+		col, row := i/8*9, 14+i%8
+		if i < int(regs.StackPointer) {
+			o.text(x, y, col, row, fmt.Sprintf("%X %04X", i, regs.Stack[i]), overlayTextColor)
+		} else {
+			o.text(x, y, col, row, fmt.Sprintf("%X ----", i), overlayDimColor)
+		}
+	}
+
+	// Keypad in its physical layout, pressed keys highlighted
+	o.text(x, y, 0, 23, "KEYPAD", overlayTitleColor)
+	layout := [4][4]uint8{{0x1, 0x2, 0x3, 0xC}, {0x4, 0x5, 0x6, 0xD}, {0x7, 0x8, 0x9, 0xE}, {0xA, 0x0, 0xB, 0xF}}
+	mask := chip8.KeypadMask()
+	for row, keys := range layout {
+		for col, key := range keys {
+			if mask&(1<<key) != 0 {
+				o.highlight(x, y, col*2, 24+row, 1, overlayPCColor)
+				o.text(x, y, col*2, 24+row, fmt.Sprintf("%X", key), overlayBgColor)
+			} else {
+				o.text(x, y, col*2, 24+row, fmt.Sprintf("%X", key), overlayTextColor)
+			}
+		}
+	}
+}
+
+// renderMemory draws the disassembly or hex view, starting a few lines
+// before PC and moved by scroll.
+func (o *Overlay) renderMemory(x, y float32) {
+	chip8 := o.chip8
+	regs := chip8.Registers()
+	memory := chip8.Memory()
+	pc := int(regs.PC)
+
+	if o.hex {
+		o.text(x, y, 0, 0, "MEMORY   M:CODE  UP/DOWN PGUP/PGDN HOME:PC", overlayTitleColor)
+
+		start := pc&^(overlayHexBytes-1) + (o.scroll-overlayMemBefore)*overlayHexBytes
+		start = max(0, min(start, len(memory)-overlayHexBytes))
+		for line := range overlayMemLines {
+			addr := start + line*overlayHexBytes
+			if addr >= len(memory) {
+				break
+			}
+			o.text(x, y, 0, 1+line, fmt.Sprintf("%04X", addr), overlayDimColor)
+			for i := range overlayHexBytes {
+				color := uint32(overlayTextColor)
+				switch {
+				case addr+i == pc || addr+i == pc+1:
+					color = overlayPCColor
+				case addr+i == int(regs.I):
+					color = overlayIndexColor
+				}
+				o.text(x, y, 6+i*3, 1+line, fmt.Sprintf("%02X", memory[addr+i]), color)
+			}
+		}
+		return
+	}
+
+	o.text(x, y, 0, 0, "CODE     M:HEX  UP/DOWN PGUP/PGDN HOME:PC", overlayTitleColor)
+
+	// Instructions can't be decoded backwards, so lines before PC assume
+	// two byte instructions
+	breakpoints := chip8.Breakpoints()
+	addr := max(0, min(pc+(o.scroll-overlayMemBefore)*2, len(memory)-2))
+	for line := range overlayMemLines {
+		if addr+1 >= len(memory) {
+			break
+		}
+
+		text, size, ok := core.Mnemonic(memory[addr:], chip8.Extension(), chip8.Quirks())
+		if !ok {
+			text, size = "???", 2
+		}
+
+		color := uint32(overlayTextColor)
+		if addr == pc {
+			o.highlight(x, y, 0, 1+line, 40, overlayCursorColor)
+			o.text(x, y, 0, 1+line, ">", overlayPCColor)
+			color = overlayPCColor
+		}
+		if slices.Contains(breakpoints, uint16(addr)) {
+			o.text(x, y, 1, 1+line, "*", overlayFaultColor)
+		}
+
+		o.text(x, y, 3, 1+line, fmt.Sprintf("%04X", addr), overlayDimColor)
+		o.text(x, y, 9, 1+line, fmt.Sprintf("% X", memory[addr:min(addr+size, len(memory))]), overlayDimColor)
+		o.text(x, y, 22, 1+line, text, color)
+		addr += size
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"chip8-emulator/core"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// WriteProfiler writes the profiler report to the file given with profiler=,
+// or stdout for -, and the RAM heatmap given with heatmap=.
+func WriteProfiler(chip8 *core.CHIP8, profiler *core.Profiler, config *Config) error {
+	if config.profilerPath == "-" {
+		if err := profiler.Report(os.Stdout, chip8, int(config.profilerTop)); err != nil {
+			return err
+		}
+	} else if config.profilerPath != "" {
+		if err := writeFile(config.profilerPath, func(file *os.File) error {
+			return profiler.Report(file, chip8, int(config.profilerTop))
+		}); err != nil {
+			return fmt.Errorf("failed to write profile: %w", err)
+		}
+	}
+
+	if config.heatmapPath != "" {
+		// The file extension picks between a PNG image and an HTML table
+		write := func(file *os.File) error { return profiler.WritePNG(file, chip8) }
+		if ext := strings.ToLower(filepath.Ext(config.heatmapPath)); ext == ".html" || ext == ".htm" {
+			write = func(file *os.File) error { return profiler.WriteHTML(file, chip8) }
+		}
+		if err := writeFile(config.heatmapPath, write); err != nil {
+			return fmt.Errorf("failed to write heatmap: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func writeFile(path string, write func(*os.File) error) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -1,85 +1,92 @@
 package main
 
 import (
+	"chip8-emulator/core"
+
 	"github.com/jupiterrider/purego-sdl3/sdl"
 )
 
 type Renderer struct {
-	chip8  *CHIP8
-	config *Config
-	sdl_t  sdl_t
+	fb         core.Framebuffer
+	config     *Config
+	sdl_t      sdl_t
+	pixelColor []uint32 // CHIP8 pixel colors to draw
+	overlay    *Overlay
 }
 
-func NewRenderer(chip8 *CHIP8, config *Config, sdl_t sdl_t) *Renderer {
-	return &Renderer{
-		chip8:  chip8,
-		config: config,
-		sdl_t:  sdl_t,
+func NewRenderer(fb core.Framebuffer, config *Config, sdl_t sdl_t, overlay *Overlay) *Renderer {
+	r := &Renderer{
+		fb:      fb,
+		config:  config,
+		sdl_t:   sdl_t,
+		overlay: overlay,
 	}
-}
-
-func (r *Renderer) SetPixel(x, y uint8, spriteBit bool) bool {
-	cols := uint8(r.config.window_width)
-	rows := uint8(r.config.window_height)
-
-	// Wrap around screen edges
-	x %= cols
-	y %= rows
-
-	pixelIndex := int(y)*int(cols) + int(x)
+	r.resetPixelColors()
 
-	collision := spriteBit && r.chip8.display[pixelIndex]
-	r.chip8.display[pixelIndex] = r.chip8.display[pixelIndex] != spriteBit
+	return r
+}
 
-	return collision
+// resetPixelColors sizes the color buffer to the current resolution and fills it with the background.
+func (r *Renderer) resetPixelColors() {
+	r.pixelColor = make([]uint32, r.fb.Width()*r.fb.Height())
+	for i := range r.pixelColor {
+		r.pixelColor[i] = r.config.bgColor
+	}
 }
 
 func (r *Renderer) Render() {
 	config := r.config
-	chip8 := r.chip8
+	fb := r.fb
 	renderer := r.sdl_t.renderer
+	width := fb.Width()
+
+	// Resolution changed (SCHIP 00FE/00FF)
+	if len(r.pixelColor) != width*fb.Height() {
+		r.resetPixelColors()
+	}
+	pixelColor := r.pixelColor
+
+	// Window size is fixed, so hires pixels are drawn at half the configured scale
+	pixelSize := float32(config.window_width) * float32(config.scale) / float32(width)
 
-	rect := sdl.FRect{X: 0, Y: 0, W: float32(config.scale), H: float32(config.scale)}
+	rect := sdl.FRect{X: 0, Y: 0, W: pixelSize, H: pixelSize}
+
+	// Background, plane 1, XO-CHIP plane 2, both planes
+	palette := [4]uint32{config.bgColor, config.fgColor, config.fg2Color, config.blendColor}
 
 	bg_r := uint8((config.bgColor >> 24) & 0xFF)
 	bg_g := uint8((config.bgColor >> 16) & 0xFF)
 	bg_b := uint8((config.bgColor >> 8) & 0xFF)
 	bg_a := uint8((config.bgColor >> 0) & 0xFF)
 
-	for i := 0; i < len(chip8.display); i++ {
-		rect.X = float32(i % int(config.window_width) * int(config.scale))
-		rect.Y = float32(i / int(config.window_width) * int(config.scale))
-
-		if chip8.display[i] {
-			if chip8.pixelColor[i] != config.fgColor {
-				chip8.pixelColor[i] = r.ColorLerp(chip8.pixelColor[i], config.fgColor, config.colorLerpRate)
-			}
-
-			red := uint8((chip8.pixelColor[i] >> 24) & 0xFF)
-			green := uint8((chip8.pixelColor[i] >> 16) & 0xFF)
-			blue := uint8((chip8.pixelColor[i] >> 8) & 0xFF)
-			alpha := uint8((chip8.pixelColor[i] >> 0) & 0xFF)
-
-			sdl.SetRenderDrawColor(renderer, red, green, blue, alpha)
-			sdl.RenderFillRect(renderer, &rect)
-
-			if config.pixelOutlines {
-				sdl.SetRenderDrawColor(renderer, bg_r, bg_g, bg_b, bg_a)
-				sdl.RenderRect(renderer, &rect)
-			}
-		} else {
-			if chip8.pixelColor[i] != config.bgColor {
-				chip8.pixelColor[i] = r.ColorLerp(chip8.pixelColor[i], config.bgColor, config.colorLerpRate)
-			}
-
-			red := uint8((chip8.pixelColor[i] >> 24) & 0xFF)
-			green := uint8((chip8.pixelColor[i] >> 16) & 0xFF)
-			blue := uint8((chip8.pixelColor[i] >> 8) & 0xFF)
-			alpha := uint8((chip8.pixelColor[i] >> 0) & 0xFF)
-
-			sdl.SetRenderDrawColor(renderer, red, green, blue, alpha)
-			sdl.RenderFillRect(renderer, &rect)
+	for i := 0; i < len(pixelColor); i++ {
+		rect.X = float32(i%width) * pixelSize
+		rect.Y = float32(i/width) * pixelSize
+
+		// Lerp towards the color of whichever bitplanes are lit
+		planes := fb.Pixel(i%width, i/width)
+		target := palette[planes&0x3]
+
+		if pixelColor[i] != target {
+			pixelColor[i] = r.ColorLerp(pixelColor[i], target, config.colorLerpRate)
 		}
+
+		red := uint8((pixelColor[i] >> 24) & 0xFF)
+		green := uint8((pixelColor[i] >> 16) & 0xFF)
+		blue := uint8((pixelColor[i] >> 8) & 0xFF)
+		alpha := uint8((pixelColor[i] >> 0) & 0xFF)
+
+		sdl.SetRenderDrawColor(renderer, red, green, blue, alpha)
+		sdl.RenderFillRect(renderer, &rect)
+
+		if planes != 0 && config.pixelOutlines {
+			sdl.SetRenderDrawColor(renderer, bg_r, bg_g, bg_b, bg_a)
+			sdl.RenderRect(renderer, &rect)
+		}
+	}
+
+	if r.overlay.Enabled() {
+		r.overlay.Render()
 	}
 }
 
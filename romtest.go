@@ -0,0 +1,26 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// RunTests runs the golden screen tests of the core package with go test,
+// passing on the golden= directory and updateGolden=true. The tests live in
+// core so they run without SDL.
+func RunTests(config *Config) error {
+	golden, err := filepath.Abs(config.goldenDir)
+	if err != nil {
+		return err
+	}
+
+	args := []string{"test", "./core", "-run", "^TestROMGoldens$", "-count=1", "-v", "-args", "-golden=" + golden}
+	if config.updateGolden {
+		args = append(args, "-update")
+	}
+
+	cmd := exec.Command("go", args...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	return cmd.Run()
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"chip8-emulator/core"
 	"unsafe"
 
 	"github.com/jupiterrider/purego-sdl3/sdl"
@@ -11,15 +12,16 @@ type Speaker struct {
 	sampleRate         int32
 	frequency          float64
 	volume             *int16
-	beeping            *bool
-	runningSampleIndex uint32 // keeps track of wave position
+	buzzer             core.Buzzer
+	runningSampleIndex uint32  // keeps track of wave position
+	patternPhase       float64 // XO-CHIP position in the 128 bit audio pattern
 }
 
-func (sp *Speaker) Init(beeping *bool, volume *int16) {
+func (sp *Speaker) Init(buzzer core.Buzzer, volume *int16) {
 	sp.sampleRate = 44100
 	sp.frequency = 440.0
 	sp.volume = volume
-	sp.beeping = beeping
+	sp.buzzer = buzzer
 
 	// Request mono, 16-bit, 44.1 kHz
 	spec := sdl.AudioSpec{
@@ -65,8 +67,35 @@ func audioCallback(userdata unsafe.Pointer, stream *sdl.AudioStream, additional,
 	halfPeriod := squareWavePeriod / 2
 
 	play := true
-	if sp.beeping != nil {
-		play = *sp.beeping
+	if sp.buzzer != nil {
+		play = sp.buzzer.Beeping()
+	}
+
+	// XO-CHIP: play the loaded 1-bit pattern instead of the square wave
+	if sp.buzzer != nil {
+		if pattern, rate, ok := sp.buzzer.AudioPattern(); ok {
+			step := rate / float64(sp.sampleRate)
+
+			for i := 0; i < n; i++ {
+				var sample int16
+				if play {
+					bit := int(sp.patternPhase)
+					if pattern[bit/8]&(0x80>>(bit%8)) != 0 {
+						sample = *sp.volume
+					} else {
+						sample = -*sp.volume
+					}
+					sp.patternPhase += step
+					for sp.patternPhase >= 128 {
+						sp.patternPhase -= 128
+					}
+				}
+				buf[i] = sample
+			}
+
+			sdl.PutAudioStreamData(stream, (*uint8)(unsafe.Pointer(&buf[0])), int32(len(buf))*bytesPerSample)
+			return
+		}
 	}
 
 	for i := 0; i < n; i++ {
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"chip8-emulator/core"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// StartTrace opens the trace file given with trace= and attaches it to the
+// machine, applying traceFormat=, traceFilter= and traceRing=.
+func StartTrace(chip8 *core.CHIP8, config *Config) (*core.Trace, *os.File, error) {
+	file, err := os.Create(config.tracePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create trace: %w", err)
+	}
+
+	trace, err := core.NewTrace(file, config.traceFormat)
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+
+	// Filters are comma separated hex ranges such as 200-2FF, or single addresses
+	if config.traceFilter != "" {
+		for _, r := range strings.Split(config.traceFilter, ",") {
+			first, last, found := strings.Cut(strings.TrimSpace(r), "-")
+			if !found {
+				last = first
+			}
+			start, err1 := strconv.ParseUint(strings.TrimPrefix(first, "0x"), 16, 16)
+			end, err2 := strconv.ParseUint(strings.TrimPrefix(last, "0x"), 16, 16)
+			if err1 != nil || err2 != nil {
+				file.Close()
+				return nil, nil, fmt.Errorf("invalid trace filter %q", r)
+			}
+			trace.AddFilter(int(start), int(end))
+		}
+	}
+
+	trace.SetRing(int(config.traceRing))
+	chip8.SetTrace(trace)
+
+	return trace, file, nil
+}